@@ -1,14 +1,26 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"lazyblog/internal/controller"
+	"lazyblog/internal/export"
+	"lazyblog/internal/idgen"
+	"lazyblog/internal/importer"
 	"lazyblog/internal/model"
+	"lazyblog/internal/notify"
+	"lazyblog/internal/rerender"
+	"lazyblog/internal/schedule"
+	"lazyblog/internal/search"
+	"lazyblog/internal/slug"
 	"lazyblog/internal/view"
 	"lazyblog/pkg/config"
 	"lazyblog/pkg/invoker"
 	"lazyblog/pkg/middleware"
+	"lazyblog/pkg/sign"
+	"os"
+	"path"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -19,14 +31,59 @@ import (
 func main() {
 	invoker.Init()
 	pflag.Bool("initdb", false, "create db tables")
+	pflag.String("export", "", "render all public pages to the given directory")
+	pflag.Bool("rerender", false, "re-render stored markdown into post content")
+	pflag.IntSlice("sid", nil, "only re-render posts with these sids")
+	pflag.String("tag", "", "only re-render posts with this tag")
+	pflag.String("category", "", "only re-render posts in this category")
+	pflag.String("import", "", "import posts from a hexo, hugo or jekyll site directory")
+	pflag.String("format", "", "site format for --import: hexo, hugo or jekyll, detected when empty")
+	pflag.Bool("dry-run", false, "print the diff or converted posts without saving")
+	pflag.Int("batch-size", 50, "posts per batch")
 	pflag.Parse()
 	viper.BindPFlags(pflag.CommandLine)
+	if err := sign.Init(); err != nil {
+		fmt.Println("load signing secret failed:", err)
+		os.Exit(1)
+	}
 	if viper.GetBool("initdb") {
 		fmt.Println("initdb...")
-		invoker.DB.AutoMigrate(model.Post{}, model.Comment{}, model.FrendLink{})
+		if n, err := slug.Prepare(); err != nil {
+			fmt.Println("backfill slugs failed:", err)
+			os.Exit(1)
+		} else if n > 0 {
+			fmt.Printf("generated slugs for %d posts\n", n)
+		}
+		if n, err := idgen.DedupComments(invoker.DB); err != nil {
+			fmt.Println("dedup comment sids failed:", err)
+			os.Exit(1)
+		} else if n > 0 {
+			fmt.Printf("reassigned sids for %d comments\n", n)
+		}
+		if err := invoker.DB.AutoMigrate(model.Post{}, model.Comment{}, model.FrendLink{}, model.Unsubscribe{}, model.Like{}, model.Revision{}, model.Redirect{}); err != nil {
+			fmt.Println("initdb failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if viper.GetBool("rerender") {
+		if err := rerenderPosts(); err != nil {
+			fmt.Println("rerender failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if dir := viper.GetString("import"); dir != "" {
+		if err := importSite(dir); err != nil {
+			fmt.Println("import failed:", err)
+			os.Exit(1)
+		}
 		return
 	}
 
+	search.Rebuild()
+	notify.Start()
+	schedule.Start()
 	etag := view.CssEtag()
 
 	router := gin.Default()
@@ -44,9 +101,15 @@ func main() {
 		"getLinks":      view.GetLinks,
 		"getCategories": view.GetCategories,
 		"getTags":       view.GetTags,
+		"parseTags":     model.ParseTags,
+		"isStatic":      export.Running,
 		"cssEtag":       func() string { return etag },
 	})
 
+	if err := router.SetTrustedProxies(config.Cfg.Site.TrustedProxies); err != nil {
+		fmt.Println("invalid site.trusted_proxies:", err)
+		os.Exit(1)
+	}
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 	if viper.GetBool("debug") {
@@ -58,23 +121,134 @@ func main() {
 	sitePrefix.Static("/static", "./static")
 	sitePrefix.GET("/", controller.Home)
 	sitePrefix.GET("/posts", controller.ListPosts)
+	sitePrefix.GET("/posts/page/:page", controller.ListPosts)
 	sitePrefix.GET("/posts/:sid", controller.PostDetail)
+	sitePrefix.GET("/posts/:sid/like", controller.GetLike)
 	sitePrefix.POST("/posts/:sid/like", controller.LikePost)
+	sitePrefix.DELETE("/posts/:sid/like", controller.UnlikePost)
 	sitePrefix.POST("/posts/:sid/comment", controller.CreateComment)
 	sitePrefix.GET("/posts/:sid/comments", controller.ListComments)
 	sitePrefix.GET("/tags", controller.ListTags)
+	sitePrefix.GET("/tags/:tag", controller.ListPosts)
+	sitePrefix.GET("/tags/:tag/page/:page", controller.ListPosts)
+	sitePrefix.GET("/tags/:tag/atom.xml", controller.TagAtomFeed)
 	sitePrefix.GET("/categories", controller.ListCategories)
+	sitePrefix.GET("/categories/:category", controller.ListPosts)
+	sitePrefix.GET("/categories/:category/page/:page", controller.ListPosts)
+	sitePrefix.GET("/categories/:category/atom.xml", controller.CategoryAtomFeed)
 	sitePrefix.GET("/archive", controller.ListArchive)
+	sitePrefix.GET("/search", controller.Search)
 	sitePrefix.GET("/about", controller.About)
 	sitePrefix.GET("/atom.xml", controller.AtomFeed)
+	sitePrefix.GET("/rss.xml", controller.RSSFeed)
+	sitePrefix.GET("/feed.json", controller.JSONFeed)
+	sitePrefix.GET("/unsubscribe", controller.Unsubscribe)
+	sitePrefix.GET("/:year/:month/:slug", controller.PostDetail)
 	// router.POST("/posts", controller.CreatePost)
-	router.POST("/admin/publish", controller.AdminCreatePost)
-	router.POST("/admin/upload", controller.AdminUploadImage) // 选择合适的图床上传
+	router.POST("/admin/publish", middleware.AdminAuth(), controller.AdminCreatePost)
+	router.POST("/admin/upload", middleware.AdminAuth(), controller.AdminUploadImage) // 选择合适的图床上传
+	router.POST("/admin/import", middleware.AdminAuth(), controller.AdminImport)
 	router.GET("/ready", func(c *gin.Context) {
 		c.String(200, "ok")
 	})
-	// api.PUT("/posts/:sid", controller.UpdatePost)
-	// api.DELETE("/posts/:sid", controller.DeletePost)
+	adminPosts := router.Group("/admin/posts", middleware.AdminAuth())
+	adminPosts.GET("", controller.AdminListPosts)
+	adminPosts.POST("/rerender", controller.AdminRerenderPosts)
+	adminPosts.GET("/:sid", controller.AdminGetPost)
+	adminPosts.PATCH("/:sid", controller.AdminPatchPost)
+	adminPosts.POST("/:sid/publish", controller.AdminPublishPost)
+	adminPosts.POST("/:sid/unpublish", controller.AdminUnpublishPost)
+	adminPosts.POST("/:sid/preview", controller.AdminPreviewPost)
+	adminPosts.DELETE("/:sid", controller.AdminDeletePost)
+	adminPosts.POST("/:sid/restore", controller.AdminRestorePost)
+	adminPosts.GET("/:sid/revisions", controller.AdminListRevisions)
+	adminPosts.GET("/:sid/revisions/diff", controller.AdminDiffRevisions)
+	adminPosts.GET("/:sid/revisions/:rev", controller.AdminGetRevision)
+	adminPosts.POST("/:sid/revisions/:rev/rollback", controller.AdminRollbackPost)
+	adminComments := router.Group("/admin/comments", middleware.AdminAuth())
+	adminComments.GET("", controller.AdminListComments)
+	adminComments.POST("/:sid/approve", controller.AdminApproveComment)
+	adminComments.POST("/:sid/reject", controller.AdminRejectComment)
+	adminComments.POST("/:sid/reply", controller.AdminReplyComment)
+	adminComments.DELETE("/:sid", controller.AdminDeleteComment)
+	adminCache := router.Group("/admin/cache", middleware.AdminAuth())
+	adminCache.GET("", controller.AdminCacheStats)
+	adminCache.DELETE("", controller.AdminPurgeCache)
+	// 其他博客迁移过来的文章的旧地址
+	router.NoRoute(controller.NotFound)
 
+	if dir := viper.GetString("export"); dir != "" {
+		if err := export.Run(router, dir); err != nil {
+			fmt.Println("export failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
 	router.Run()
 }
+
+// rerenderPosts --rerender, 逐篇输出进度, --dry-run 时输出 diff
+func rerenderPosts() error {
+	opts := rerender.Options{
+		SIDs:      viper.GetIntSlice("sid"),
+		Tag:       viper.GetString("tag"),
+		Category:  viper.GetString("category"),
+		DryRun:    viper.GetBool("dry-run"),
+		BatchSize: viper.GetInt("batch-size"),
+		Progress: func(done, total int, post model.Post, changed bool) {
+			status := "unchanged"
+			if changed {
+				status = "changed"
+			}
+			fmt.Printf("[%d/%d] %d %s: %s\n", done, total, post.SID, post.Title, status)
+		},
+	}
+	report, err := rerender.Run(opts)
+	if err != nil {
+		return err
+	}
+	for _, post := range report.Posts {
+		if post.Error != "" {
+			fmt.Printf("%d %s: %s\n", post.SID, post.Title, post.Error)
+		}
+		if post.Diff != "" {
+			fmt.Print(post.Diff)
+		}
+	}
+	action := "updated"
+	if report.DryRun {
+		action = "would update"
+	}
+	fmt.Printf("rerender: %d posts, %s %d, %d failed\n", report.Total, action, report.Changed, report.Failed)
+	return nil
+}
+
+// importSite --import, 把 hexo、hugo、jekyll 的文章转换后与 /admin/import 一样在一个事务中导入,
+// --dry-run 时只输出转换后的文章
+func importSite(dir string) error {
+	files, err := importer.Load(dir, viper.GetString("format"))
+	if err != nil {
+		return err
+	}
+	if viper.GetBool("dry-run") {
+		for _, file := range files {
+			if ext := path.Ext(file.Name); ext == ".md" || ext == ".markdown" {
+				fmt.Printf("==> %s\n%s\n", file.Name, file.Data)
+			}
+		}
+		return nil
+	}
+	importFiles := make([]controller.ImportFile, 0, len(files))
+	for _, file := range files {
+		importFiles = append(importFiles, controller.ImportFile{Name: file.Name, Data: file.Data})
+	}
+	report, importErr := controller.ImportPosts(importFiles)
+	if report != nil {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	}
+	return importErr
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"container/list"
+	"lazyblog/pkg/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats 单个缓存的统计信息
+type Stats struct {
+	Name          string `json:"name"`
+	Entries       int    `json:"entries"`
+	MaxEntries    int    `json:"max_entries"`
+	TTL           string `json:"ttl"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`     // 超出容量被淘汰的条目
+	Invalidations uint64 `json:"invalidations"` // 被主动清除的条目
+}
+
+type entry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+// Cache 带过期时间和容量上限的 LRU 缓存, 并发安全
+type Cache struct {
+	name       string
+	ttl        time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	stats Stats
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Cache)
+)
+
+// New 按 [cache] 配置创建缓存并注册到统计中, cache.enable 为 false 时缓存不保存任何内容
+func New(name string) *Cache {
+	cfg := config.Cfg.Cache
+	c := &Cache{
+		name:       name,
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+	if !cfg.Enable {
+		c.maxEntries = 0
+	}
+	registryMu.Lock()
+	registry[name] = c
+	registryMu.Unlock()
+	return c
+}
+
+func (c *Cache) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		if c.ttl <= 0 || time.Now().Before(e.expires) {
+			c.ll.MoveToFront(el)
+			c.stats.Hits++
+			return e.value, true
+		}
+		c.removeElement(el)
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *Cache) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxEntries <= 0 {
+		return
+	}
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, value: value, expires: expires})
+	for c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Delete 清除指定的条目
+func (c *Cache) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.removeElement(el)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+// Purge 清空缓存
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Invalidations += uint64(c.ll.Len())
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Name = c.name
+	stats.Entries = c.ll.Len()
+	stats.MaxEntries = c.maxEntries
+	stats.TTL = c.ttl.String()
+	return stats
+}
+
+// Remember 命中时直接返回缓存的值, 否则调用 load 并缓存结果
+func Remember[V any](c *Cache, key string, load func() V) V {
+	if value, ok := c.Get(key); ok {
+		if v, ok := value.(V); ok {
+			return v
+		}
+	}
+	v := load()
+	c.Set(key, v)
+	return v
+}
+
+// PurgeAll 清空所有缓存, 在文章发生变化时调用
+func PurgeAll() {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, c := range registry {
+		c.Purge()
+	}
+}
+
+// AllStats 按名称排序的所有缓存统计
+func AllStats() []Stats {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	stats := make([]Stats, 0, len(registry))
+	for _, c := range registry {
+		stats = append(stats, c.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
@@ -5,7 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"lazyblog/internal/cache"
+	"lazyblog/internal/idgen"
+	"lazyblog/internal/markdown"
 	"lazyblog/internal/model"
+	"lazyblog/internal/schedule"
+	"lazyblog/internal/search"
+	"lazyblog/internal/slug"
 	"lazyblog/pkg/config"
 	"lazyblog/pkg/constant"
 	"lazyblog/pkg/invoker"
@@ -17,25 +23,13 @@ import (
 	"strings"
 	"time"
 
-	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/gin-gonic/gin"
-	"github.com/yuin/goldmark"
-	highlighting "github.com/yuin/goldmark-highlighting/v2"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
-	"go.abhg.dev/goldmark/mermaid"
 	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
 )
 
+// AdminCreatePost 上传单篇 markdown 发表或更新文章, 路由需要放在 middleware.AdminAuth() 之后
 func AdminCreatePost(c *gin.Context) {
-	token := c.GetHeader("X-Admin-Token")
-
-	if token != config.Cfg.Auth.XAdminToken {
-		c.JSON(401, gin.H{"error": "unauthorized"})
-		return
-	}
-
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(400, gin.H{"error": "file is required"})
@@ -84,17 +78,22 @@ func AdminCreatePost(c *gin.Context) {
 }
 
 type blog struct {
-	Title       string `yaml:"title"`
-	Markdown    string `yaml:"markdown"` // Markdown content
-	Description string `yaml:"description"`
-	Author      string `yaml:"author"`
-	Published   bool   `yaml:"published"`
-	PubDate     string `yaml:"pubdate"`
-	Tags        string `yaml:"tags"`     // Comma-separated tags
-	Category    string `yaml:"category"` // Category of the post
+	Title       string `yaml:"title" json:"title"`
+	Slug        string `yaml:"slug,omitempty" json:"slug,omitempty"` // 为空时由标题生成
+	Markdown    string `yaml:"markdown,omitempty" json:"-"`          // Markdown content
+	Description string `yaml:"description" json:"description"`
+	Author      string `yaml:"author" json:"author"`
+	Published   bool   `yaml:"published" json:"published"`
+	PubDate     string `yaml:"pubdate" json:"pubdate"`
+	Tags        string `yaml:"tags" json:"tags"`                   // Comma-separated tags
+	Category    string `yaml:"category" json:"category"`           // Category of the post
+	Toc         *bool  `yaml:"toc,omitempty" json:"toc,omitempty"` // 是否显示目录, 默认显示
+
+	Aliases []string `yaml:"aliases,omitempty" json:"aliases,omitempty"` // 301 跳转到这篇文章的旧地址
 }
 
-func parse(content string, filename string) (*blog, error) {
+// parseBlog 解析 front-matter 和正文
+func parseBlog(content string) (*blog, error) {
 	// 找到 front-matter
 	if !strings.HasPrefix(content, "---") {
 		return nil, fmt.Errorf("file missing front-matter")
@@ -113,77 +112,103 @@ func parse(content string, filename string) (*blog, error) {
 		return nil, fmt.Errorf("yaml parse error: %w", err)
 	}
 	blog.Markdown = bodyPart
+	return blog, nil
+}
 
-	var post model.Post
+// applyBlog 将 front-matter 中的字段写入 post 并重新渲染
+func applyBlog(db *gorm.DB, post *model.Post, blog *blog) error {
+	post.Title = blog.Title
+	if err := slug.Assign(db, post, blog.Slug); err != nil {
+		return err
+	}
+	post.Description = blog.Description
+	post.Author = blog.Author
+	post.Published = blog.Published
+	pubDate, err := model.ParsePubDate(blog.PubDate)
+	if err != nil {
+		return err
+	}
+	post.PubDate = pubDate
+	post.Tags = blog.Tags
+	post.Category = blog.Category
+	post.Markdown = blog.Markdown
+	post.HideToc = blog.Toc != nil && !*blog.Toc
+	return markdown.RenderPost(post)
+}
 
-	markdown := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("monokai"),
-				highlighting.WithFormatOptions(
-					chromahtml.WithLineNumbers(true),
-				),
-			),
-			&mermaid.Extender{RenderMode: mermaid.RenderModeClient, Theme: "dark"},
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			html.WithHardWraps(),
-			html.WithXHTML(),
-		),
-	)
+func parse(content string, filename string) (*blog, error) {
+	blog, err := parseBlog(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var post model.Post
 
 	if err := invoker.DB.Model(&model.Post{}).Where("file = ?", filename).First(&post).Error; err == nil {
 		fmt.Println("Post already exists, updating...")
-		post.Title = blog.Title
-		post.Description = blog.Description
-		post.Author = blog.Author
-		post.Published = blog.Published
-		post.PubDate, _ = time.Parse("2006-01-02", blog.PubDate)
-		post.Tags = blog.Tags
-		post.Category = blog.Category
-		post.Markdown = bodyPart
-		var buf bytes.Buffer
-		if err := markdown.Convert([]byte(bodyPart), &buf); err != nil {
-			return nil, fmt.Errorf("markdown conversion error: %w", err)
+		before := post
+		if err := applyBlog(invoker.DB, &post, blog); err != nil {
+			return nil, err
 		}
-		post.Content = buf.String()
-		invoker.DB.Save(&post)
+		err := invoker.DB.Transaction(func(tx *gorm.DB) error {
+			if err := saveEdit(tx, before, &post, "publish"); err != nil {
+				return fmt.Errorf("save post error: %w", slug.SaveError(err, post))
+			}
+			if err := saveAliases(tx, post, blog.Aliases); err != nil {
+				return fmt.Errorf("save aliases error: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		search.Index(post)
+		cache.PurgeAll()
+		schedule.Reschedule()
 	} else {
 		// create new post
 		fmt.Println("Creating new post...")
-		post.Title = blog.Title
-		post.Description = blog.Description
-		post.Author = blog.Author
-		post.Published = blog.Published
-		post.PubDate, _ = time.Parse("2006-01-02", blog.PubDate)
-		post.Tags = blog.Tags
-		post.Category = blog.Category
-		post.Markdown = bodyPart
+		if err := applyBlog(invoker.DB, &post, blog); err != nil {
+			return nil, err
+		}
 		post.File = filename
-		var buf bytes.Buffer
-		if err := markdown.Convert([]byte(bodyPart), &buf); err != nil {
-			return nil, fmt.Errorf("markdown conversion error: %w", err)
+		err := invoker.DB.Transaction(func(tx *gorm.DB) error {
+			if err := createPost(tx, &post); err != nil {
+				return fmt.Errorf("save post error: %w", err)
+			}
+			if err := saveAliases(tx, post, blog.Aliases); err != nil {
+				return fmt.Errorf("save aliases error: %w", err)
+			}
+			if err := saveRevision(tx, post, "publish"); err != nil {
+				return fmt.Errorf("save revision error: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
-		post.Content = buf.String()
-		post.SID = model.GenerateSID()
-		invoker.DB.Create(&post)
+		search.Index(post)
+		cache.PurgeAll()
+		schedule.Reschedule()
 	}
 
 	return blog, nil
 }
 
-func AdminUploadImage(c *gin.Context) {
-	token := c.GetHeader("X-Admin-Token")
-
-	if token != config.Cfg.Auth.XAdminToken {
-		c.JSON(401, gin.H{"error": "unauthorized"})
-		return
-	}
+// createPost 插入新文章并分配 SID, 标题无法生成 slug 时使用 post-<sid>
+func createPost(db *gorm.DB, post *model.Post) error {
+	fallback := post.Slug == ""
+	err := idgen.Create(db, post, func(sid int) {
+		post.SID = sid
+		if fallback {
+			post.Slug = slug.Fallback(sid)
+		}
+	})
+	return slug.SaveError(err, *post)
+}
 
+// AdminUploadImage 上传图片到启用的图床, 路由需要放在 middleware.AdminAuth() 之后
+func AdminUploadImage(c *gin.Context) {
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(400, gin.H{"error": "file is required"})
@@ -329,14 +354,8 @@ type link struct {
 	Email string `json:"email"`
 }
 
+// AdminCreateLink 添加友情链接, 目前没有注册路由, 注册时需要放在 middleware.AdminAuth() 之后
 func AdminCreateLink(c *gin.Context) {
-	token := c.GetHeader("X-Admin-Token")
-
-	if token != config.Cfg.Auth.XAdminToken {
-		c.JSON(401, gin.H{"error": "unauthorized"})
-		return
-	}
-
 	var req link
 	if err := c.Bind(&req); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid request"})
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"lazyblog/internal/idgen"
+	"lazyblog/internal/model"
+	"lazyblog/internal/notify"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+)
+
+type adminCommentItem struct {
+	SID       int        `json:"sid"`
+	PostSID   int        `json:"post_sid"`
+	ParentSID int        `json:"parent_sid"`
+	Content   string     `json:"content"`
+	Nickname  string     `json:"nickname"`
+	Email     string     `json:"email"`
+	Website   string     `json:"website"`
+	Approved  bool       `json:"approved"`
+	IsAuthor  bool       `json:"is_author"`
+	PubDate   time.Time  `json:"pub_date"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func newAdminCommentItem(comment model.Comment) adminCommentItem {
+	item := adminCommentItem{
+		SID:       comment.SID,
+		PostSID:   comment.PostSID,
+		ParentSID: comment.ParentSID,
+		Content:   comment.Content,
+		Nickname:  comment.Nickname,
+		Email:     comment.Email,
+		Website:   comment.Website,
+		Approved:  comment.Approved,
+		IsAuthor:  comment.IsAuthor,
+		PubDate:   comment.PubDate,
+	}
+	if comment.DeletedAt.Valid {
+		item.DeletedAt = &comment.DeletedAt.Time
+	}
+	return item
+}
+
+func findAdminComment(c *gin.Context, unscoped bool) (*model.Comment, bool) {
+	db := invoker.DB
+	if unscoped {
+		db = db.Unscoped()
+	}
+	var comment model.Comment
+	err := db.Model(model.Comment{}).Where("sid = ?", c.Param("sid")).First(&comment).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return nil, false
+	}
+	return &comment, true
+}
+
+// AdminListComments 默认列出待审核的评论, status 可选 pending, approved, rejected, all
+func AdminListComments(c *gin.Context) {
+	page := cast.ToInt(c.Query("page"))
+	if page <= 0 {
+		page = 1
+	}
+	size := cast.ToInt(c.Query("size"))
+	if size <= 0 {
+		size = 20
+	}
+
+	query := invoker.DB.Model(model.Comment{})
+	switch c.DefaultQuery("status", "pending") {
+	case "pending":
+		query = query.Where("approved = ?", false)
+	case "approved":
+		query = query.Where("approved = ?", true)
+	case "rejected":
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	case "all":
+		query = query.Unscoped()
+	}
+	if postSID := c.Query("post_sid"); postSID != "" {
+		query = query.Where("post_sid = ?", postSID)
+	}
+
+	var total int64
+	query.Count(&total)
+	comments := make([]model.Comment, 0)
+	query.Order("pub_date DESC").Offset((page - 1) * size).Limit(size).Find(&comments)
+
+	items := make([]adminCommentItem, 0, len(comments))
+	for _, comment := range comments {
+		items = append(items, newAdminCommentItem(comment))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"comments": items,
+		"page":     page,
+		"size":     size,
+		"total":    total,
+	})
+}
+
+func AdminApproveComment(c *gin.Context) {
+	comment, ok := findAdminComment(c, false)
+	if !ok {
+		return
+	}
+	if err := invoker.DB.Model(comment).Update("approved", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	comment.Approved = true
+	invalidateComments(comment.PostSID)
+	var post model.Post
+	if err := invoker.DB.Model(model.Post{}).Where("id = ?", comment.PostID).First(&post).Error; err == nil {
+		notify.Reply(post, *comment)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "comment approved", "comment": newAdminCommentItem(*comment)})
+}
+
+// AdminRejectComment 拒绝的评论只做软删除, 仍可通过 status=rejected 查看
+func AdminRejectComment(c *gin.Context) {
+	comment, ok := findAdminComment(c, false)
+	if !ok {
+		return
+	}
+	err := invoker.DB.Model(comment).Update("approved", false).Error
+	if err == nil {
+		err = invoker.DB.Delete(comment).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	invalidateComments(comment.PostSID)
+	c.JSON(http.StatusOK, gin.H{"message": "comment rejected", "sid": comment.SID})
+}
+
+// AdminDeleteComment 永久删除评论
+func AdminDeleteComment(c *gin.Context) {
+	comment, ok := findAdminComment(c, true)
+	if !ok {
+		return
+	}
+	if err := invoker.DB.Unscoped().Delete(comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	invalidateComments(comment.PostSID)
+	c.JSON(http.StatusOK, gin.H{"message": "comment deleted", "sid": comment.SID})
+}
+
+type adminReplyRequest struct {
+	Content  string `json:"content"`
+	Nickname string `json:"nickname"`
+}
+
+// AdminReplyComment 以博主身份回复评论, 回复直接公开
+func AdminReplyComment(c *gin.Context) {
+	parent, ok := findAdminComment(c, false)
+	if !ok {
+		return
+	}
+	var req adminReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content is required"})
+		return
+	}
+	nickname := req.Nickname
+	if nickname == "" {
+		nickname = config.Cfg.Site.Author
+	}
+	if nickname == "" {
+		nickname = "博主"
+	}
+
+	reply := model.Comment{
+		PostID:    parent.PostID,
+		PostSID:   parent.PostSID,
+		ParentSID: parent.SID,
+		Content:   req.Content,
+		Nickname:  nickname,
+		Approved:  true,
+		IsAuthor:  true,
+		PubDate:   time.Now(),
+	}
+	if err := idgen.Create(invoker.DB, &reply, func(sid int) { reply.SID = sid }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	invalidateComments(reply.PostSID)
+	var post model.Post
+	if err := invoker.DB.Model(model.Post{}).Where("id = ?", reply.PostID).First(&post).Error; err == nil {
+		notify.Reply(post, reply)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "reply created", "comment": newAdminCommentItem(reply)})
+}
@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"lazyblog/internal/cache"
+	"lazyblog/internal/markdown"
+	"lazyblog/internal/model"
+	"lazyblog/internal/rerender"
+	"lazyblog/internal/schedule"
+	"lazyblog/internal/search"
+	"lazyblog/internal/slug"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+type adminPostItem struct {
+	SID         int        `json:"sid"`
+	Slug        string     `json:"slug"`
+	URL         string     `json:"url"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Author      string     `json:"author"`
+	Published   bool       `json:"published"`
+	PubDate     time.Time  `json:"pub_date"`
+	Tags        string     `json:"tags"`
+	Category    string     `json:"category"`
+	LikesCount  int64      `json:"likes_count"`
+	File        string     `json:"file"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+func newAdminPostItem(post model.Post) adminPostItem {
+	item := adminPostItem{
+		SID:         post.SID,
+		Slug:        post.Slug,
+		URL:         config.Cfg.Site.AbsURL(post.Path()),
+		Title:       post.Title,
+		Description: post.Description,
+		Author:      post.Author,
+		Published:   post.Published,
+		PubDate:     post.PubDate,
+		Tags:        post.Tags,
+		Category:    post.Category,
+		LikesCount:  post.LikesCount,
+		File:        post.File,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+	}
+	if post.DeletedAt.Valid {
+		item.DeletedAt = &post.DeletedAt.Time
+	}
+	return item
+}
+
+// postToBlog 由数据库中的字段还原 front-matter
+func postToBlog(post model.Post) *blog {
+	b := &blog{
+		Title:       post.Title,
+		Slug:        post.Slug,
+		Description: post.Description,
+		Author:      post.Author,
+		Published:   post.Published,
+		Tags:        post.Tags,
+		Category:    post.Category,
+	}
+	b.PubDate = model.FormatPubDate(post.PubDate)
+	if post.HideToc {
+		toc := false
+		b.Toc = &toc
+	}
+	return b
+}
+
+// postSource 还原出可重新发布的 markdown 文件内容
+func postSource(post model.Post) (string, error) {
+	frontMatter, err := yaml.Marshal(postToBlog(post))
+	if err != nil {
+		return "", err
+	}
+	return formatSource(string(frontMatter), post.Markdown), nil
+}
+
+// formatSource 拼接 front-matter 和 markdown
+func formatSource(frontMatter, markdown string) string {
+	return fmt.Sprintf("---\n%s---\n\n%s\n", frontMatter, markdown)
+}
+
+// findAdminPost 按 sid 查找文章, unscoped 为 true 时包含已删除的文章
+func findAdminPost(c *gin.Context, unscoped bool) (*model.Post, bool) {
+	db := invoker.DB
+	if unscoped {
+		db = db.Unscoped()
+	}
+	var post model.Post
+	err := db.Model(model.Post{}).Where("sid = ?", c.Param("sid")).First(&post).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+		return nil, false
+	}
+	return &post, true
+}
+
+// saveFailed 保存文章失败时的响应, slug 唯一索引冲突时返回 400
+func saveFailed(c *gin.Context, post model.Post, err error) {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": slug.SaveError(err, post).Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// AdminListPosts 列出所有文章, 包括草稿; deleted=true 时同时列出已删除的文章
+func AdminListPosts(c *gin.Context) {
+	page := cast.ToInt(c.Query("page"))
+	if page <= 0 {
+		page = 1
+	}
+	size := cast.ToInt(c.Query("size"))
+	if size <= 0 {
+		size = 20
+	}
+
+	query := invoker.DB.Model(model.Post{})
+	if cast.ToBool(c.Query("deleted")) {
+		query = query.Unscoped()
+	}
+	switch c.Query("status") {
+	case "published":
+		query = query.Where("published = ?", true)
+	case "draft":
+		query = query.Where("published = ?", false)
+	case "scheduled":
+		query = query.Where("published = ? AND pub_date > ?", true, time.Now().UTC())
+	}
+
+	var total int64
+	query.Count(&total)
+	posts := make([]model.Post, 0)
+	query.Order("pub_date DESC").Offset((page - 1) * size).Limit(size).Find(&posts)
+
+	items := make([]adminPostItem, 0, len(posts))
+	for _, post := range posts {
+		items = append(items, newAdminPostItem(post))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"posts": items,
+		"page":  page,
+		"size":  size,
+		"total": total,
+	})
+}
+
+// AdminGetPost 返回文章的 front-matter 和原始 markdown
+func AdminGetPost(c *gin.Context) {
+	post, ok := findAdminPost(c, true)
+	if !ok {
+		return
+	}
+	source, err := postSource(*post)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"post":         newAdminPostItem(*post),
+		"front_matter": postToBlog(*post),
+		"markdown":     post.Markdown,
+		"source":       source,
+	})
+}
+
+type patchPostRequest struct {
+	Title       *string `json:"title"`
+	Slug        *string `json:"slug"`
+	Description *string `json:"description"`
+	Author      *string `json:"author"`
+	PubDate     *string `json:"pubdate"`
+	Tags        *string `json:"tags"`
+	Category    *string `json:"category"`
+	Markdown    *string `json:"markdown"`
+	Published   *bool   `json:"published"`
+	Toc         *bool   `json:"toc"`
+}
+
+// AdminPatchPost 只更新请求中出现的字段, 修改 markdown 时重新渲染
+func AdminPatchPost(c *gin.Context) {
+	post, ok := findAdminPost(c, false)
+	if !ok {
+		return
+	}
+	var req patchPostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	before := *post
+	if req.Title != nil {
+		post.Title = *req.Title
+	}
+	if req.Slug != nil {
+		if err := slug.Assign(invoker.DB, post, *req.Slug); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Description != nil {
+		post.Description = *req.Description
+	}
+	if req.Author != nil {
+		post.Author = *req.Author
+	}
+	if req.PubDate != nil {
+		pubDate, err := model.ParsePubDate(*req.PubDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		post.PubDate = pubDate
+	}
+	if req.Tags != nil {
+		post.Tags = *req.Tags
+	}
+	if req.Category != nil {
+		post.Category = *req.Category
+	}
+	if req.Published != nil {
+		post.Published = *req.Published
+	}
+	if req.Toc != nil {
+		post.HideToc = !*req.Toc
+	}
+	if req.Markdown != nil {
+		post.Markdown = *req.Markdown
+		if err := markdown.RenderPost(post); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := saveEdit(invoker.DB, before, post, "edit"); err != nil {
+		saveFailed(c, *post, err)
+		return
+	}
+	search.Index(*post)
+	cache.PurgeAll()
+	schedule.Reschedule()
+	c.JSON(http.StatusOK, gin.H{"message": "post updated successfully", "post": newAdminPostItem(*post)})
+}
+
+func setPublished(c *gin.Context, published bool) {
+	post, ok := findAdminPost(c, false)
+	if !ok {
+		return
+	}
+	if err := invoker.DB.Model(post).Update("published", published).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	post.Published = published
+	search.Index(*post)
+	cache.PurgeAll()
+	schedule.Reschedule()
+	c.JSON(http.StatusOK, gin.H{"message": "success", "post": newAdminPostItem(*post)})
+}
+
+func AdminPublishPost(c *gin.Context) {
+	setPublished(c, true)
+}
+
+func AdminUnpublishPost(c *gin.Context) {
+	setPublished(c, false)
+}
+
+// AdminDeletePost 软删除, 可通过 AdminRestorePost 恢复
+func AdminDeletePost(c *gin.Context) {
+	post, ok := findAdminPost(c, false)
+	if !ok {
+		return
+	}
+	if err := invoker.DB.Delete(post).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	search.Remove(post.ID)
+	cache.PurgeAll()
+	c.JSON(http.StatusOK, gin.H{"message": "post deleted successfully", "sid": post.SID})
+}
+
+func AdminRestorePost(c *gin.Context) {
+	post, ok := findAdminPost(c, true)
+	if !ok {
+		return
+	}
+	if !post.DeletedAt.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "post is not deleted"})
+		return
+	}
+	if err := invoker.DB.Unscoped().Model(post).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	post.DeletedAt = gorm.DeletedAt{}
+	search.Index(*post)
+	cache.PurgeAll()
+	schedule.Reschedule()
+	c.JSON(http.StatusOK, gin.H{"message": "post restored successfully", "post": newAdminPostItem(*post)})
+}
+
+// AdminRerenderPosts 用当前的 markdown 配置重新渲染文章, 请求体与 rerender.Options 相同, 为空时处理全部文章
+func AdminRerenderPosts(c *gin.Context) {
+	var opts rerender.Options
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	opts.Progress = func(done, total int, post model.Post, changed bool) {
+		log.Printf("rerender: %d/%d sid=%d changed=%v", done, total, post.SID, changed)
+	}
+	report, err := rerender.Run(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
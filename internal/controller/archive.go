@@ -2,6 +2,7 @@ package controller
 
 import (
 	"fmt"
+	"lazyblog/internal/cache"
 	"lazyblog/internal/model"
 	"lazyblog/pkg/invoker"
 	"net/http"
@@ -22,8 +23,12 @@ type ListArchiveData struct {
 }
 
 func ListArchive(c *gin.Context) {
+	c.HTML(http.StatusOK, "archive.tmpl", cache.Remember(pages, "archive", loadArchive))
+}
+
+func loadArchive() ListArchiveData {
 	posts := make([]model.Post, 0)
-	invoker.DB.Model(model.Post{}).Where("published = ?", true).Order("pub_date DESC").Find(&posts)
+	invoker.DB.Model(model.Post{}).Scopes(model.Live()).Order("pub_date DESC").Find(&posts)
 	results := make([]ListArchiveItem, 0)
 
 	archiveMap := make(map[string][]model.Post)
@@ -49,7 +54,7 @@ func ListArchive(c *gin.Context) {
 		return results[i].Month > results[j].Month
 	})
 
-	c.HTML(http.StatusOK, "archive.tmpl", ListArchiveData{
+	return ListArchiveData{
 		Title: "文章归档",
-		Data:  results})
+		Data:  results}
 }
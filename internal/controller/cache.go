@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"fmt"
+	"lazyblog/internal/cache"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pages 首页、归档和文章详情页用到的数据
+var pages = cache.New("pages")
+
+// lookups slug 和旧地址对应的文章, 包括找不到的结果. 与 pages 分开,
+// 扫描大量不存在的地址时只会淘汰这里的条目, 不会挤掉缓存的页面
+var lookups = cache.New("lookups")
+
+func postCacheKey(sid int) string {
+	return fmt.Sprintf("post:%d", sid)
+}
+
+// invalidateComments 评论变化后清除文章详情和首页的最新评论
+func invalidateComments(postSID int) {
+	pages.Delete(postCacheKey(postSID), "home")
+}
+
+// invalidateLikes 点赞数变化后清除文章详情
+func invalidateLikes(postSID int) {
+	pages.Delete(postCacheKey(postSID))
+}
+
+// AdminCacheStats 各缓存的命中统计
+func AdminCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"caches": cache.AllStats()})
+}
+
+func AdminPurgeCache(c *gin.Context) {
+	cache.PurgeAll()
+	c.JSON(http.StatusOK, gin.H{"msg": "success"})
+}
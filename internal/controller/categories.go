@@ -20,7 +20,7 @@ type ListCategoriesData struct {
 
 func ListCategories(c *gin.Context) {
 	results := make([]ListCategoriesItem, 0)
-	invoker.DB.Model(model.Post{}).Select("category, count(*) as count").Where("published = ?", true).Group("category").Find(&results)
+	invoker.DB.Model(model.Post{}).Select("category, count(*) as count").Scopes(model.Live()).Group("category").Find(&results)
 
 	c.HTML(http.StatusOK, "categories.tmpl", ListCategoriesData{
 		Title: "文章分类",
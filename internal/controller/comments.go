@@ -1,8 +1,13 @@
 package controller
 
 import (
+	"lazyblog/internal/idgen"
 	"lazyblog/internal/model"
+	"lazyblog/internal/notify"
+	"lazyblog/internal/spam"
+	"lazyblog/pkg/config"
 	"lazyblog/pkg/invoker"
+	"log"
 	"net/http"
 	"time"
 
@@ -14,8 +19,12 @@ type CreateCommentRequest struct {
 	Nickname string `form:"nickname"`
 	Email    string `form:"email"`
 	Website  string `form:"website"`
+	Parent   int    `form:"parent"` // 回复的评论 sid
+	Honeypot string `form:"address"`
 }
 
+var commentFilter = spam.NewPipeline(config.Cfg.Comment)
+
 func CreateComment(c *gin.Context) {
 	sid := c.Param("sid")
 	if sid == "" {
@@ -23,7 +32,7 @@ func CreateComment(c *gin.Context) {
 		return
 	}
 	var post model.Post
-	err := invoker.DB.Model(model.Post{}).Where("sid = ?", sid).First(&post).Error
+	err := invoker.DB.Model(model.Post{}).Scopes(model.Live()).Where("sid = ?", sid).First(&post).Error
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
@@ -34,39 +43,124 @@ func CreateComment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
-
-	comment := model.Comment{
-		SID:      model.GenerateSID(),
-		PostID:   post.ID,
-		PostSID:  post.SID,
+	submission := &spam.Submission{
+		IP:       c.ClientIP(),
 		Content:  req.Content,
 		Nickname: req.Nickname,
 		Email:    req.Email,
 		Website:  req.Website,
-		Approved: true,
-		PubDate:  time.Now(),
+		Honeypot: req.Honeypot,
+	}
+	if r := commentFilter.Check(submission); r != nil {
+		log.Printf("comment rejected: check=%s ip=%s post=%d nickname=%q email=%q website=%q content=%q",
+			r.Check, submission.IP, post.SID, req.Nickname, req.Email, req.Website, req.Content)
+		c.JSON(r.Status, gin.H{"error": r.Reason})
+		return
+	}
+	if req.Parent != 0 && !parentExists(post, req.Parent) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid parent comment"})
+		return
+	}
+
+	comment := model.Comment{
+		PostID:    post.ID,
+		PostSID:   post.SID,
+		ParentSID: req.Parent,
+		Content:   req.Content,
+		Nickname:  req.Nickname,
+		Email:     req.Email,
+		Website:   req.Website,
+		Approved:  !config.Cfg.Comment.Moderation,
+		PubDate:   time.Now(),
+	}
+	if err := idgen.Create(invoker.DB, &comment, func(sid int) { comment.SID = sid }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save comment"})
+		return
+	}
+	invalidateComments(post.SID)
+	notify.NewComment(post, comment)
+	if comment.Approved {
+		notify.Reply(post, comment)
 	}
-	invoker.DB.Create(&comment)
-	c.JSON(http.StatusOK, gin.H{"msg": "success"})
+	c.JSON(http.StatusOK, gin.H{"msg": "success", "approved": comment.Approved})
+}
+
+// parentExists 被回复的评论必须属于同一篇文章且已公开
+func parentExists(post model.Post, parentSID int) bool {
+	var count int64
+	invoker.DB.Model(model.Comment{}).Where("sid = ? AND post_id = ? AND approved = ?", parentSID, post.ID, true).Count(&count)
+	return count > 0
 }
 
 type commentViewItem struct {
-	Content  string `json:"content"`
-	Nickname string `json:"nickname"`
-	Website  string `json:"website"`
-	PubDate  string `json:"pub_date"`
+	SID       int                `json:"sid"`
+	ParentSID int                `json:"parent_sid"`
+	Content   string             `json:"content"`
+	Nickname  string             `json:"nickname"`
+	Website   string             `json:"website"`
+	IsAuthor  bool               `json:"is_author"`
+	ReplyTo   string             `json:"reply_to,omitempty"` // 被回复者的昵称
+	PubDate   time.Time          `json:"pub_date"`
+	Replies   []*commentViewItem `json:"replies"`
+
+	depth  int
+	parent *commentViewItem
+}
+
+// commentTree 返回文章已公开评论组成的树, 顶层评论按时间倒序, 回复按时间正序.
+// 超过 comment.max_depth 的回复挂到最深一层的祖先下面.
+func commentTree(post model.Post) []*commentViewItem {
+	comments := make([]model.Comment, 0)
+	invoker.DB.Model(model.Comment{}).Where("post_id = ? AND approved = ?", post.ID, true).Order("pub_date ASC").Find(&comments)
+
+	maxDepth := config.Cfg.Comment.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = 1
+	}
+	nodes := make(map[int]*commentViewItem, len(comments))
+	roots := make([]*commentViewItem, 0)
+	for _, comment := range comments {
+		node := &commentViewItem{
+			SID:       comment.SID,
+			ParentSID: comment.ParentSID,
+			Content:   comment.Content,
+			Nickname:  comment.Nickname,
+			Website:   comment.Website,
+			IsAuthor:  comment.IsAuthor,
+			PubDate:   comment.PubDate,
+			Replies:   make([]*commentViewItem, 0),
+		}
+		nodes[comment.SID] = node
+		parent, ok := nodes[comment.ParentSID]
+		if ok {
+			node.ReplyTo = parent.Nickname
+		}
+		for parent != nil && parent.depth >= maxDepth-1 {
+			parent = parent.parent
+		}
+		if parent == nil {
+			roots = append(roots, node)
+			continue
+		}
+		node.parent = parent
+		node.depth = parent.depth + 1
+		parent.Replies = append(parent.Replies, node)
+	}
+	// 顶层评论最新的在前
+	for i, j := 0, len(roots)-1; i < j; i, j = i+1, j-1 {
+		roots[i], roots[j] = roots[j], roots[i]
+	}
+	return roots
 }
 
 func ListComments(c *gin.Context) {
 	sid := c.Param("sid")
 	var post model.Post
-	err := invoker.DB.Model(model.Post{}).Where("sid = ?", sid).First(&post).Error
+	err := invoker.DB.Model(model.Post{}).Scopes(model.Live()).Where("sid = ?", sid).First(&post).Error
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
-	comments := make([]commentViewItem, 0)
-	invoker.DB.Model(model.Comment{}).Where("post_id = ?", post.ID).Order("pub_date DESC").Find(&comments)
 
-	c.JSON(http.StatusOK, comments)
+	c.JSON(http.StatusOK, commentTree(post))
 }
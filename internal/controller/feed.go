@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type feedEntry struct {
+	ID        string // tag URI, 文章地址变化时也不会改变
+	Title     string
+	URL       string // 绝对地址
+	Summary   string
+	Content   string // 渲染后的 HTML
+	Author    string
+	Tags      []string
+	Published time.Time
+	Updated   time.Time
+}
+
+// feedData atom.xml, rss.xml, feed.json 共用的数据
+type feedData struct {
+	ID      string
+	Title   string
+	SiteURL string
+	FeedURL string
+	Author  string
+	Updated time.Time
+	Entries []feedEntry
+}
+
+// feedAuthor 文章作者为空时依次使用 site.author 和站点标题
+func feedAuthor(author string) string {
+	if author != "" {
+		return author
+	}
+	if config.Cfg.Site.Author != "" {
+		return config.Cfg.Site.Author
+	}
+	return config.Cfg.Site.Title
+}
+
+// tagURI 按 RFC 4151 生成 tag:host,date:path 形式的 ID
+func tagURI(date, path string) string {
+	host := config.Cfg.Site.Domain
+	if u, err := url.Parse(config.Cfg.Site.AbsURL("")); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+	return fmt.Sprintf("tag:%s,%s:%s%s", host, date, config.Cfg.Site.Prefix, path)
+}
+
+// feedPosts 所有 feed 共用的查询: 只包含已发布的文章, 最新的在前
+func feedPosts(scopes ...func(*gorm.DB) *gorm.DB) []model.Post {
+	limit := config.Cfg.Feed.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	posts := make([]model.Post, 0)
+	invoker.DB.Model(model.Post{}).Scopes(model.Live()).Scopes(scopes...).
+		Order("pub_date DESC").Limit(limit).Find(&posts)
+	return posts
+}
+
+// loadFeed 构建 feed, pagePath 为对应的列表页, feedPath 为 feed 自身在站点内的路径, 如 /atom.xml
+func loadFeed(title, pagePath, feedPath string, scopes ...func(*gorm.DB) *gorm.DB) feedData {
+	site := config.Cfg.Site
+	data := feedData{
+		ID:      tagURI(config.Cfg.Feed.Since, feedPath),
+		Title:   title,
+		SiteURL: site.AbsURL(pagePath),
+		FeedURL: site.AbsURL(feedPath),
+		Author:  feedAuthor(""),
+		Entries: make([]feedEntry, 0),
+	}
+	for _, post := range feedPosts(scopes...) {
+		entry := feedEntry{
+			ID:        tagURI(post.CreatedAt.Format("2006-01-02"), fmt.Sprintf("/posts/%d", post.SID)),
+			Title:     post.Title,
+			URL:       site.AbsURL(post.Path()),
+			Summary:   post.Description,
+			Content:   post.Content,
+			Author:    feedAuthor(post.Author),
+			Tags:      model.ParseTags(post.Tags),
+			Published: post.PubDate,
+			Updated:   post.UpdatedAt,
+		}
+		if entry.Updated.Before(entry.Published) {
+			entry.Updated = entry.Published
+		}
+		if entry.Updated.After(data.Updated) {
+			data.Updated = entry.Updated
+		}
+		data.Entries = append(data.Entries, entry)
+	}
+	return data
+}
+
+// renderFeedTemplate 渲染 xml 模板并设置正确的 Content-Type
+func renderFeedTemplate(c *gin.Context, name, contentType string, data feedData) {
+	// 模板同样会被 LoadHTMLGlob 加载, 只能使用内置函数, 用 html 转义即可得到合法的 xml
+	tpl, err := template.ParseFiles("templates/pages/" + name)
+	if err != nil {
+		c.String(500, "template parse error: %v", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		c.String(500, "template execute error: %v", err)
+		return
+	}
+	writeFeed(c, contentType, buf.Bytes(), data.Updated)
+}
+
+// writeFeed 设置 ETag 和 Last-Modified, 内容未变化时返回 304
+func writeFeed(c *gin.Context, contentType string, body []byte, updated time.Time) {
+	sum := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if !updated.IsZero() {
+		c.Header("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				c.Status(http.StatusNotModified)
+				return
+			}
+		}
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !updated.IsZero() {
+		if !updated.Truncate(time.Second).After(since) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
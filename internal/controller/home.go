@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"lazyblog/internal/cache"
 	"lazyblog/internal/model"
 	"lazyblog/pkg/invoker"
 	"net/http"
@@ -12,12 +13,27 @@ type HomeData struct {
 	Title    string
 	Posts    []model.Post
 	Comments []model.Comment
+
+	PostPaths map[int]string // 最新评论所属文章的地址, 以 SID 为 key
 }
 
 func Home(c *gin.Context) {
-	var posts []model.Post
-	invoker.DB.Model(model.Post{}).Where("published = ?", true).Order("pub_date desc").Limit(10).Find(&posts)
-	var comments []model.Comment
-	invoker.DB.Model(model.Comment{}).Where("approved = ?", true).Order("pub_date desc").Limit(10).Find(&comments)
-	c.HTML(http.StatusOK, "index.tmpl", HomeData{Title: "首页", Posts: posts, Comments: comments})
+	data := cache.Remember(pages, "home", func() HomeData {
+		var posts []model.Post
+		invoker.DB.Model(model.Post{}).Scopes(model.Live()).Order("pub_date desc").Limit(10).Find(&posts)
+		var comments []model.Comment
+		invoker.DB.Model(model.Comment{}).Where("approved = ?", true).Order("pub_date desc").Limit(10).Find(&comments)
+		sids := make([]int, 0, len(comments))
+		for _, comment := range comments {
+			sids = append(sids, comment.PostSID)
+		}
+		var commented []model.Post
+		invoker.DB.Model(model.Post{}).Select("sid", "slug", "pub_date", "created_at").Where("sid IN ?", sids).Find(&commented)
+		paths := make(map[int]string, len(commented))
+		for _, post := range commented {
+			paths[post.SID] = post.Path()
+		}
+		return HomeData{Title: "首页", Posts: posts, Comments: comments, PostPaths: paths}
+	})
+	c.HTML(http.StatusOK, "index.tmpl", data)
 }
@@ -0,0 +1,506 @@
+package controller
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"lazyblog/internal/cache"
+	"lazyblog/internal/importer"
+	"lazyblog/internal/model"
+	"lazyblog/internal/schedule"
+	"lazyblog/internal/search"
+	"lazyblog/internal/slug"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const uploadsDir = "static/uploads" // 没有启用图床时图片保存的位置
+
+// 导入包的限制, 测试中调低
+var (
+	maxImportBytes = 256 << 20 // 导入包解压后的总大小上限
+	maxImportFiles = 5000
+)
+
+// ImportFile 导入包中的一个文件, Name 为包内使用 / 分隔的相对路径
+type ImportFile struct {
+	Name string
+	Data []byte
+}
+
+// ImportResult 单个 markdown 文件的导入结果
+type ImportResult struct {
+	File     string   `json:"file"`
+	Status   string   `json:"status"` // created, updated, failed, skipped
+	SID      int      `json:"sid,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"` // 包中找不到的图片等
+}
+
+type ImportReport struct {
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Failed  int            `json:"failed"`
+	Images  int            `json:"images"` // 上传的图片数
+	Posts   []ImportResult `json:"posts"`
+}
+
+// errImportFailed 至少一个文件校验或发表失败, 所有文章都没有发表
+var errImportFailed = errors.New("import failed, no post was published")
+
+type importPost struct {
+	file    ImportFile
+	blog    *blog
+	result  *ImportResult
+	replace func(ref string) (string, bool) // 图片的相对地址 -> 上传后的地址
+}
+
+// AdminImport 上传 zip、tar 或 tar.gz 包, 发表其中所有的 .md 文件, 并上传文章引用的图片
+func AdminImport(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, int64(maxImportBytes)+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	files, err := readArchive(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := ImportPosts(files)
+	switch {
+	case errors.Is(err, errImportFailed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "report": report})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+	default:
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// readArchive 按文件头识别 zip、tar 和 tar.gz, 跳过目录、隐藏文件和 __MACOSX
+func readArchive(data []byte) ([]ImportFile, error) {
+	if len(data) > maxImportBytes {
+		return nil, fmt.Errorf("archive is larger than %d MB", maxImportBytes>>20)
+	}
+	files := make([]ImportFile, 0)
+	total := 0
+	add := func(name string, r io.Reader) error {
+		name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+		for _, part := range strings.Split(name, "/") {
+			if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+				return nil
+			}
+		}
+		if len(files) >= maxImportFiles {
+			return fmt.Errorf("archive contains more than %d files", maxImportFiles)
+		}
+		content, err := io.ReadAll(io.LimitReader(r, int64(maxImportBytes-total)+1))
+		if err != nil {
+			return err
+		}
+		if total += len(content); total > maxImportBytes {
+			return fmt.Errorf("archive is larger than %d MB after decompression", maxImportBytes>>20)
+		}
+		files = append(files, ImportFile{Name: name, Data: content})
+		return nil
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("read zip error: %w", err)
+		}
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, fmt.Errorf("read %s error: %w", zf.Name, err)
+			}
+			err = add(zf.Name, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return files, nil
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("read gzip error: %w", err)
+		}
+		defer gz.Close()
+		return files, readTar(gz, add)
+	default:
+		return files, readTar(bytes.NewReader(data), add)
+	}
+}
+
+func readTar(r io.Reader, add func(name string, r io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unsupported archive, expected zip, tar or tar.gz: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := add(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func isMarkdown(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// ImportPosts 校验所有 markdown 文件的 front-matter, 上传文章引用的图片并改写为上传后的地址,
+// 然后在一个事务中发表全部文章. 任何一个文件失败时都不会发表, 返回 errImportFailed 和各文件的结果
+func ImportPosts(files []ImportFile) (*ImportReport, error) {
+	report := &ImportReport{Posts: make([]ImportResult, 0)}
+	assets := make(map[string][]byte)
+	posts := make([]*importPost, 0)
+	for _, file := range files {
+		if !isMarkdown(file.Name) {
+			assets[file.Name] = file.Data
+			continue
+		}
+		report.Posts = append(report.Posts, ImportResult{File: file.Name})
+	}
+	if len(report.Posts) == 0 {
+		return report, fmt.Errorf("%w: no markdown files found", errImportFailed)
+	}
+
+	// 校验, 包内的相对路径作为更新已有文章的依据, 不能重复
+	i := 0
+	names := make(map[string]int)
+	slugs := make(map[string]string)
+	for _, file := range files {
+		if !isMarkdown(file.Name) {
+			continue
+		}
+		p := &importPost{file: file, result: &report.Posts[i]}
+		i++
+		posts = append(posts, p)
+		names[file.Name]++
+		b, err := validateImport(file)
+		if err != nil {
+			p.result.Error = err.Error()
+			continue
+		}
+		p.blog = b
+		p.result.Title = b.Title
+		if b.Slug != "" {
+			s := slug.Make(b.Slug)
+			if other, ok := slugs[s]; ok {
+				p.result.Error = fmt.Sprintf("slug %q is also used by %s", s, other)
+			}
+			slugs[s] = file.Name
+		}
+	}
+	for _, p := range posts {
+		if names[p.file.Name] > 1 && p.result.Error == "" {
+			p.result.Error = fmt.Sprintf("duplicate file %s", p.file.Name)
+		}
+	}
+	if failImport(report) {
+		return report, errImportFailed
+	}
+
+	// 上传图片, 同一张图片只上传一次
+	uploaded := make(map[string]string)
+	for _, p := range posts {
+		for _, asset := range referencedAssets(p.blog.Markdown, p.file.Name, assets, &p.result.Warnings) {
+			if _, ok := uploaded[asset]; ok {
+				continue
+			}
+			if !uploadable(asset) {
+				p.result.Warnings = append(p.result.Warnings, fmt.Sprintf("%s is not an allowed image type, not uploaded", asset))
+				continue
+			}
+			u, err := uploadImage(assets[asset], asset)
+			if err != nil {
+				p.result.Error = fmt.Sprintf("upload %s error: %v", asset, err)
+				break
+			}
+			uploaded[asset] = u
+			report.Images++
+		}
+		if p.result.Error != "" {
+			break
+		}
+		p.replace = func(ref string) (string, bool) {
+			u, ok := uploaded[resolveAsset(ref, p.file.Name, assets)]
+			return u, ok
+		}
+		p.blog.Markdown = rewriteImages(p.blog.Markdown, p.replace)
+	}
+	if failImport(report) {
+		return report, errImportFailed
+	}
+
+	saved := make([]model.Post, 0, len(posts))
+	err := invoker.DB.Transaction(func(tx *gorm.DB) error {
+		for _, p := range posts {
+			post, err := importPostTx(tx, p)
+			if err != nil {
+				p.result.Error = err.Error()
+				return err
+			}
+			saved = append(saved, post)
+		}
+		return nil
+	})
+	if err != nil {
+		failImport(report)
+		return report, errImportFailed
+	}
+
+	// 与单篇发表一样备份到 posts/, 图片已改写为上传后的地址
+	if err := os.MkdirAll("posts", 0755); err != nil {
+		log.Printf("import: create posts dir error: %v", err)
+	}
+	for _, p := range posts {
+		switch p.result.Status {
+		case "created":
+			report.Created++
+		case "updated":
+			report.Updated++
+		}
+		backup := filepath.Join("posts", filepath.FromSlash(p.file.Name))
+		if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+			log.Printf("import: create %s error: %v", filepath.Dir(backup), err)
+		}
+		if err := os.WriteFile(backup, []byte(rewriteImages(string(p.file.Data), p.replace)), 0644); err != nil {
+			log.Printf("import: save backup %s error: %v", backup, err)
+		}
+	}
+	for _, post := range saved {
+		search.Index(post)
+	}
+	cache.PurgeAll()
+	schedule.Reschedule()
+	return report, nil
+}
+
+// validateImport 解析并校验 front-matter, 与发表时的检查一致
+func validateImport(file ImportFile) (*blog, error) {
+	b, err := parseBlog(string(file.Data))
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(b.Title) == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if _, err := model.ParsePubDate(b.PubDate); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// importPostTx 在事务中新建或更新文章, 记录旧地址和历史版本. 文章按包内的相对路径对应,
+// 包根目录下的文件与单篇发表一样就是文件名; 子目录中的文件与单篇发表的同名文章来源不同, 报告冲突而不覆盖
+func importPostTx(tx *gorm.DB, p *importPost) (model.Post, error) {
+	filename := p.file.Name
+	var post model.Post
+	exists := tx.Model(model.Post{}).Where("file = ?", filename).Limit(1).Find(&post).Error == nil && post.ID != 0
+	if !exists && path.Base(filename) != filename {
+		var other model.Post
+		if err := tx.Model(model.Post{}).Where("file = ?", path.Base(filename)).Limit(1).Find(&other).Error; err != nil {
+			return post, err
+		}
+		if other.ID != 0 {
+			return post, fmt.Errorf("conflicts with post %d published as %s, rename the file or delete that post first", other.SID, other.File)
+		}
+	}
+	if exists {
+		if err := saveRevision(tx, post, "snapshot"); err != nil {
+			return post, err
+		}
+	}
+	before := post
+	if err := applyBlog(tx, &post, p.blog); err != nil {
+		return post, err
+	}
+	if exists {
+		if err := tx.Save(&post).Error; err != nil {
+			return post, slug.SaveError(err, post)
+		}
+		if err := keepOldPath(tx, before, post); err != nil {
+			return post, err
+		}
+		p.result.Status = "updated"
+	} else {
+		post.File = filename
+		if err := createPost(tx, &post); err != nil {
+			return post, err
+		}
+		p.result.Status = "created"
+	}
+	if err := saveAliases(tx, post, p.blog.Aliases); err != nil {
+		return post, err
+	}
+	if err := saveRevision(tx, post, "import"); err != nil {
+		return post, err
+	}
+	p.result.SID = post.SID
+	p.result.URL = config.Cfg.Site.AbsURL(post.Path())
+	return post, nil
+}
+
+// failImport 有文件失败时把其余文件标记为 skipped, 返回是否失败
+func failImport(report *ImportReport) bool {
+	failed := 0
+	for _, r := range report.Posts {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return false
+	}
+	report.Created, report.Updated, report.Failed = 0, 0, failed
+	for i := range report.Posts {
+		r := &report.Posts[i]
+		r.SID, r.URL = 0, ""
+		if r.Error != "" {
+			r.Status = "failed"
+		} else {
+			r.Status = "skipped"
+		}
+	}
+	return true
+}
+
+var (
+	markdownImage = regexp.MustCompile(`(!\[[^\]]*\]\(\s*<?)([^)\s>]+)`)
+	htmlImage     = regexp.MustCompile(`(<img\b[^>]*?\bsrc=["'])([^"']+)`)
+)
+
+// rewriteImages 用 replace 的结果替换 markdown 和 <img> 中的图片地址, replace 返回 false 时保留原地址
+func rewriteImages(markdown string, replace func(ref string) (string, bool)) string {
+	for _, pattern := range []*regexp.Regexp{markdownImage, htmlImage} {
+		markdown = pattern.ReplaceAllStringFunc(markdown, func(match string) string {
+			m := pattern.FindStringSubmatch(match)
+			if u, ok := replace(m[2]); ok {
+				return m[1] + u
+			}
+			return match
+		})
+	}
+	return markdown
+}
+
+// resolveAsset 把文章中的相对地址解析为包内的文件, 依次尝试相对文章所在目录、
+// 与文章同名的资源目录(hexo 的 post_asset_folder)和包的根目录, 找不到时返回空字符串
+func resolveAsset(ref, mdName string, assets map[string][]byte) string {
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "//") || strings.Contains(ref, ":") {
+		return ""
+	}
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		ref = ref[:i]
+	}
+	if unescaped, err := url.PathUnescape(ref); err == nil {
+		ref = unescaped
+	}
+	dir := path.Dir(mdName)
+	candidates := []string{
+		path.Join(dir, ref),
+		path.Join(dir, strings.TrimSuffix(path.Base(mdName), path.Ext(mdName)), ref),
+		path.Clean("/" + ref)[1:],
+	}
+	if strings.HasPrefix(ref, "/") {
+		candidates = candidates[2:]
+	}
+	for _, name := range candidates {
+		if _, ok := assets[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// referencedAssets 文章引用的包内文件, 找不到的相对地址记录到 warnings
+func referencedAssets(markdown, mdName string, assets map[string][]byte, warnings *[]string) []string {
+	found := make([]string, 0)
+	rewriteImages(markdown, func(ref string) (string, bool) {
+		if asset := resolveAsset(ref, mdName, assets); asset != "" {
+			found = append(found, asset)
+		} else if !strings.HasPrefix(ref, "/") && !strings.Contains(ref, ":") && !strings.HasPrefix(ref, "#") {
+			*warnings = append(*warnings, fmt.Sprintf("image %s not found in archive", ref))
+		}
+		return "", false
+	})
+	return found
+}
+
+// uploadable 只上传扩展名在图片白名单中的文件. svg 可以包含脚本, 保存到 static/uploads 后
+// 与站点同源, 也不上传
+func uploadable(name string) bool {
+	return importer.IsImage(name) && !strings.EqualFold(path.Ext(name), ".svg")
+}
+
+// uploadImage 有启用的图床时上传到图床, 否则保存到 static/uploads, 以内容的哈希命名
+func uploadImage(data []byte, name string) (string, error) {
+	for _, hostConfig := range config.Cfg.ImageHostings {
+		if hostConfig.Enable {
+			result, err := uploadToImageHosting(data, path.Base(name))
+			if err != nil {
+				return "", err
+			}
+			return result["url"], nil
+		}
+	}
+	sum := sha1.Sum(data)
+	filename := hex.EncodeToString(sum[:10]) + strings.ToLower(path.Ext(name))
+	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(uploadsDir, filename), data, 0644); err != nil {
+		return "", err
+	}
+	return config.Cfg.Site.Prefix + "/" + uploadsDir + "/" + filename, nil
+}
@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/invoker"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	name string
+	data string
+}
+
+func makeZip(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTar(t *testing.T, entries []archiveEntry, compress bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e.name, "/") {
+			header = &tar.Header{Name: e.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.data))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	return buf.Bytes()
+}
+
+// setLimit 临时调低导入包的限制
+func setLimit(t *testing.T, limit *int, value int) {
+	t.Helper()
+	old := *limit
+	*limit = value
+	t.Cleanup(func() { *limit = old })
+}
+
+func TestReadArchive(t *testing.T) {
+	entries := []archiveEntry{
+		{"a.md", "a"},
+		{"dir/", ""},
+		{"dir/b.md", "b"},
+		{"dir/img/c.png", "c"},
+		{".hidden.md", "hidden"},
+		{"dir/.git/config", "git"},
+		{"__MACOSX/dir/._b.md", "resource fork"},
+		{"../up.md", "up"},
+	}
+	want := []string{"a.md", "dir/b.md", "dir/img/c.png", "up.md"}
+	archives := map[string][]byte{
+		"zip": makeZip(t, entries),
+		"tar": makeTar(t, entries, false),
+		"tgz": makeTar(t, entries, true),
+	}
+	for kind, data := range archives {
+		t.Run(kind, func(t *testing.T) {
+			files, err := readArchive(data)
+			if err != nil {
+				t.Fatalf("readArchive: %v", err)
+			}
+			names := make([]string, 0, len(files))
+			for _, f := range files {
+				names = append(names, f.Name)
+				if f.Name == "dir/b.md" && string(f.Data) != "b" {
+					t.Errorf("dir/b.md = %q, want %q", f.Data, "b")
+				}
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("files = %v, want %v", names, want)
+			}
+		})
+	}
+
+	if _, err := readArchive([]byte("not an archive")); err == nil {
+		t.Error("readArchive accepted plain text")
+	}
+}
+
+func TestReadArchiveLimits(t *testing.T) {
+	t.Run("files", func(t *testing.T) {
+		setLimit(t, &maxImportFiles, 2)
+		entries := []archiveEntry{{"a.md", "a"}, {"b.md", "b"}, {"c.md", "c"}}
+		if _, err := readArchive(makeZip(t, entries)); err == nil || !strings.Contains(err.Error(), "more than 2 files") {
+			t.Errorf("err = %v, want too many files", err)
+		}
+		// 跳过的文件不计数
+		entries[2].name = "__MACOSX/c.md"
+		if _, err := readArchive(makeZip(t, entries)); err != nil {
+			t.Errorf("err = %v", err)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		setLimit(t, &maxImportBytes, 1024)
+		if _, err := readArchive(make([]byte, 2048)); err == nil || !strings.Contains(err.Error(), "larger than") {
+			t.Errorf("err = %v, want archive too large", err)
+		}
+	})
+
+	// 压缩后很小的文件解压后超过限制, 读到上限即停止
+	t.Run("decompression", func(t *testing.T) {
+		setLimit(t, &maxImportBytes, 1024)
+		zeros := strings.Repeat("\x00", 600)
+		entries := []archiveEntry{{"a.md", zeros}, {"b.md", zeros}}
+		archives := map[string][]byte{
+			"zip": makeZip(t, entries),
+			"tgz": makeTar(t, entries, true),
+		}
+		for kind, data := range archives {
+			if len(data) > maxImportBytes {
+				t.Fatalf("%s archive is %d bytes, want it under the limit", kind, len(data))
+			}
+			if _, err := readArchive(data); err == nil || !strings.Contains(err.Error(), "after decompression") {
+				t.Errorf("%s: err = %v, want decompression limit", kind, err)
+			}
+		}
+		if _, err := readArchive(makeZip(t, entries[:1])); err != nil {
+			t.Errorf("archive under the limit: %v", err)
+		}
+	})
+}
+
+func TestResolveAsset(t *testing.T) {
+	assets := map[string][]byte{
+		"posts/img/a.png":   nil,
+		"posts/img/a b.png": nil,
+		"posts/hello/b.png": nil,
+		"img/d.png":         nil,
+		"c.png":             nil,
+	}
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"img/a.png", "posts/img/a.png"},
+		{"./img/a.png", "posts/img/a.png"},
+		{"img/a.png?v=1#top", "posts/img/a.png"},
+		{"img/a%20b.png", "posts/img/a b.png"},
+		{"b.png", "posts/hello/b.png"}, // 与文章同名的资源目录
+		{"../c.png", "c.png"},
+		{"../img/d.png", "img/d.png"},
+		{"c.png", "c.png"}, // 包的根目录
+		{"/img/d.png", "img/d.png"},
+		{"/img/a.png", ""}, // / 开头只相对包的根目录
+		{"/../../c.png", "c.png"},
+		{"../../../../c.png", "c.png"},
+		{"missing.png", ""},
+		{"https://example.com/a.png", ""},
+		{"//cdn.example.com/c.png", ""},
+		{"#c.png", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := resolveAsset(tt.ref, "posts/hello.md", assets); got != tt.want {
+			t.Errorf("resolveAsset(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteImages(t *testing.T) {
+	uploaded := map[string]string{
+		"img/a.png":  "https://img.example.com/a.png",
+		"../b.png":   "https://img.example.com/b.png",
+		"/img/c.png": "https://img.example.com/c.png",
+	}
+	replace := func(ref string) (string, bool) {
+		u, ok := uploaded[ref]
+		return u, ok
+	}
+	markdown := strings.Join([]string{
+		`![a](img/a.png "title")`,
+		`![b]( <../b.png> )`,
+		`<img class="wide" src="/img/c.png" alt="c">`,
+		`<img src='img/a.png'>`,
+		`[not an image](img/a.png)`,
+		`![missing](missing.png)`,
+	}, "\n")
+	want := strings.Join([]string{
+		`![a](https://img.example.com/a.png "title")`,
+		`![b]( <https://img.example.com/b.png> )`,
+		`<img class="wide" src="https://img.example.com/c.png" alt="c">`,
+		`<img src='https://img.example.com/a.png'>`,
+		`[not an image](img/a.png)`,
+		`![missing](missing.png)`,
+	}, "\n")
+	if got := rewriteImages(markdown, replace); got != want {
+		t.Errorf("rewriteImages:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func importMarkdown(title, slug, body string) string {
+	return "---\ntitle: " + title + "\nslug: " + slug + "\npubdate: 2024-01-02\npublished: true\n---\n\n" + body + "\n"
+}
+
+func TestImportPosts(t *testing.T) {
+	reset(t)
+	t.Chdir(t.TempDir())
+	files := []ImportFile{
+		{Name: "posts/hello.md", Data: []byte(importMarkdown("Hello", "hello", "![a](../img/a.png) ![b](/img/a.png)"))},
+		{Name: "img/a.png", Data: []byte("png")},
+	}
+	report, err := ImportPosts(files)
+	if err != nil {
+		t.Fatalf("ImportPosts: %v, %+v", err, report)
+	}
+	if report.Created != 1 || report.Images != 1 {
+		t.Errorf("report = %+v, want 1 created with 1 image", report)
+	}
+	var post model.Post
+	invoker.DB.Where("slug = ?", "hello").First(&post)
+	if post.File != "posts/hello.md" {
+		t.Errorf("file = %q, want the path in the archive", post.File)
+	}
+	if strings.Contains(post.Markdown, "img/a.png") || strings.Count(post.Markdown, "/"+uploadsDir+"/") != 2 {
+		t.Errorf("markdown = %q, want both images rewritten", post.Markdown)
+	}
+	if _, err := os.Stat("posts/posts/hello.md"); err != nil {
+		t.Errorf("backup: %v", err)
+	}
+
+	// 再次导入按相对路径更新同一篇文章
+	files[0].Data = []byte(importMarkdown("Hello again", "hello", "updated"))
+	report, err = ImportPosts(files[:1])
+	if err != nil || report.Updated != 1 || report.Posts[0].SID != post.SID {
+		t.Fatalf("reimport = %+v, %v, want post %d updated", report, err, post.SID)
+	}
+}
+
+func TestImportPostsRollback(t *testing.T) {
+	reset(t)
+	t.Chdir(t.TempDir())
+	// 单篇发表的文章, 文件名与包中子目录里的文件相同
+	single := model.Post{Title: "Single", Slug: "single", File: "hello.md", Markdown: "single"}
+	if err := createPost(invoker.DB, &single); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []ImportFile{
+		{Name: "a.md", Data: []byte(importMarkdown("A", "a", "a"))},
+		{Name: "hello.md", Data: []byte(importMarkdown("Root hello", "root-hello", "root"))},
+		{Name: "_posts/hello.md", Data: []byte(importMarkdown("Hexo hello", "hexo-hello", "hexo"))},
+	}
+	report, err := ImportPosts(files)
+	if !errors.Is(err, errImportFailed) {
+		t.Fatalf("err = %v, want errImportFailed", err)
+	}
+	statuses := make(map[string]string)
+	for _, r := range report.Posts {
+		statuses[r.File] = r.Status
+		if r.File == "_posts/hello.md" && !strings.Contains(r.Error, "conflicts with post") {
+			t.Errorf("error = %q, want a conflict with the single post", r.Error)
+		}
+	}
+	want := map[string]string{"a.md": "skipped", "hello.md": "skipped", "_posts/hello.md": "failed"}
+	if !reflect.DeepEqual(statuses, want) || report.Created != 0 || report.Updated != 0 || report.Failed != 1 {
+		t.Errorf("report = %+v, want %v", report, want)
+	}
+
+	var posts []model.Post
+	invoker.DB.Find(&posts)
+	if len(posts) != 1 || posts[0].Title != "Single" || posts[0].Markdown != "single" {
+		t.Errorf("posts = %+v, want only the unchanged single post", posts)
+	}
+	var revisions, redirects int64
+	invoker.DB.Model(model.Revision{}).Count(&revisions)
+	invoker.DB.Model(model.Redirect{}).Count(&redirects)
+	if revisions != 0 || redirects != 0 {
+		t.Errorf("%d revisions and %d redirects saved, want none", revisions, redirects)
+	}
+	if _, err := os.Stat("posts"); !os.IsNotExist(err) {
+		t.Errorf("backup written for a failed import: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"encoding/json"
+	"lazyblog/pkg/config"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSON Feed 1.1, https://www.jsonfeed.org/version/1.1/
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished time.Time        `json:"date_published"`
+	DateModified  time.Time        `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+func JSONFeed(c *gin.Context) {
+	data := loadFeed(config.Cfg.Site.Title, "/", "/feed.json")
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       data.Title,
+		HomePageURL: data.SiteURL,
+		FeedURL:     data.FeedURL,
+		Authors:     []jsonFeedAuthor{{Name: data.Author}},
+		Items:       make([]jsonFeedItem, 0, len(data.Entries)),
+	}
+	for _, entry := range data.Entries {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            entry.ID,
+			URL:           entry.URL,
+			Title:         entry.Title,
+			ContentHTML:   entry.Content,
+			Summary:       entry.Summary,
+			DatePublished: entry.Published,
+			DateModified:  entry.Updated,
+			Authors:       []jsonFeedAuthor{{Name: entry.Author}},
+			Tags:          entry.Tags,
+		})
+	}
+	body, err := json.Marshal(feed)
+	if err != nil {
+		c.String(500, "json marshal error: %v", err)
+		return
+	}
+	writeFeed(c, "application/feed+json; charset=utf-8", body, data.Updated)
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"lazyblog/internal/model"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"lazyblog/pkg/sign"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const visitorCookie = "lazyblog_vid"
+
+// visitorID 返回访客指纹. cookie 带签名防止伪造; 没有 cookie 时使用哈希后的 IP,
+// 并把它写入 cookie, 这样同一 IP 即使不保存 cookie 也只能点赞一次.
+func visitorID(c *gin.Context) string {
+	if value, err := c.Cookie(visitorCookie); err == nil {
+		id, sig, ok := strings.Cut(value, ".")
+		if ok && sign.Verify("visitor:"+id, sig) {
+			return id
+		}
+	}
+	id := sign.Sign("ip:" + c.ClientIP())[:32]
+	path := config.Cfg.Site.Prefix
+	if path == "" {
+		path = "/"
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(visitorCookie, id+"."+sign.Sign("visitor:"+id), 365*24*3600, path, "", false, true)
+	return id
+}
+
+func findLikePost(c *gin.Context) (*model.Post, bool) {
+	var post model.Post
+	err := invoker.DB.Model(model.Post{}).Scopes(model.Live()).Where("sid = ?", c.Param("sid")).First(&post).Error
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return nil, false
+	}
+	return &post, true
+}
+
+func likeStatus(c *gin.Context, post *model.Post, fingerprint string) {
+	var count int64
+	invoker.DB.Model(model.Like{}).Where("post_id = ? AND fingerprint = ?", post.ID, fingerprint).Count(&count)
+	invoker.DB.Model(model.Post{}).Select("likes_count").Where("id = ?", post.ID).Scan(&post.LikesCount)
+	c.JSON(http.StatusOK, gin.H{"msg": "success", "liked": count > 0, "likes_count": post.LikesCount})
+}
+
+// GetLike 返回当前访客是否已点赞
+func GetLike(c *gin.Context) {
+	post, ok := findLikePost(c)
+	if !ok {
+		return
+	}
+	likeStatus(c, post, visitorID(c))
+}
+
+// LikePost 幂等点赞, 重复点赞不会增加计数
+func LikePost(c *gin.Context) {
+	post, ok := findLikePost(c)
+	if !ok {
+		return
+	}
+	fingerprint := visitorID(c)
+	err := invoker.DB.Transaction(func(tx *gorm.DB) error {
+		like := model.Like{PostID: post.ID, Fingerprint: fingerprint}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&like)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(model.Post{}).Where("id = ?", post.ID).UpdateColumn("likes_count", gorm.Expr("likes_count + ?", 1)).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to like post"})
+		return
+	}
+	invalidateLikes(post.SID)
+	likeStatus(c, post, fingerprint)
+}
+
+func UnlikePost(c *gin.Context) {
+	post, ok := findLikePost(c)
+	if !ok {
+		return
+	}
+	fingerprint := visitorID(c)
+	err := invoker.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("post_id = ? AND fingerprint = ?", post.ID, fingerprint).Delete(&model.Like{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(model.Post{}).Where("id = ? AND likes_count > 0", post.ID).UpdateColumn("likes_count", gorm.Expr("likes_count - ?", 1)).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlike post"})
+		return
+	}
+	invalidateLikes(post.SID)
+	likeStatus(c, post, fingerprint)
+}
@@ -2,9 +2,15 @@ package controller
 
 import (
 	"html/template"
+	"lazyblog/internal/cache"
 	"lazyblog/internal/model"
+	"lazyblog/internal/view"
+	"lazyblog/pkg/config"
 	"lazyblog/pkg/invoker"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
@@ -16,10 +22,17 @@ type ListPostsData struct {
 	Page      int
 	Size      int
 	TotalPage int
+	BaseURL   string // 分页链接的前缀, 如 /posts, /tags/go
+	FeedURL   string // 标签、分类页对应的 atom.xml
 }
 
+// ListPosts 同时支持 /posts?tags=&category=&page= 和 /tags/:tag/page/:page 这类
+// 不带查询参数的地址, 后者可以直接导出为静态页面
 func ListPosts(c *gin.Context) {
 	pageStr := c.Query("page")
+	if c.Param("page") != "" {
+		pageStr = c.Param("page")
+	}
 	page := cast.ToInt(pageStr)
 	if page <= 0 {
 		page = 1
@@ -30,16 +43,36 @@ func ListPosts(c *gin.Context) {
 		size = 10
 	}
 	tag := c.Query("tags")
+	if c.Param("tag") != "" {
+		tag = c.Param("tag")
+	}
 	category := c.Query("category")
+	if c.Param("category") != "" {
+		category = c.Param("category")
+	}
+
+	title := "文章列表"
+	baseURL := "/posts"
+	feedURL := ""
+	if tag != "" {
+		title = "标签: " + tag
+		baseURL = "/tags/" + url.PathEscape(tag)
+		feedURL = baseURL + "/atom.xml"
+	}
+	if category != "" {
+		title = "分类: " + category
+		baseURL = "/categories/" + url.PathEscape(category)
+		feedURL = baseURL + "/atom.xml"
+	}
 
 	posts := make([]model.Post, 0)
 
-	query := invoker.DB.Model(model.Post{}).Where("published = ?", true)
+	query := invoker.DB.Model(model.Post{}).Scopes(model.Live())
 	if tag != "" {
-		query = query.Where("FIND_IN_SET(?, tags)", tag)
+		query = query.Scopes(model.WithTag(tag))
 	}
 	if category != "" {
-		query = query.Where("category = ?", category)
+		query = query.Scopes(model.WithCategory(category))
 	}
 	query = query.Order("pub_date DESC")
 	var total int64
@@ -51,52 +84,101 @@ func ListPosts(c *gin.Context) {
 		totalPage += 1
 	}
 	c.HTML(http.StatusOK, "posts.tmpl", ListPostsData{
-		Title:     "文章列表",
+		Title:     title,
 		Posts:     posts,
 		Page:      page,
 		Size:      size,
 		TotalPage: totalPage,
+		BaseURL:   baseURL,
+		FeedURL:   feedURL,
 	})
 }
 
 type PostDetailData struct {
 	Post     model.Post
-	Comments []model.Comment
+	Comments []*commentViewItem
 	Content  template.HTML
+	Toc      []*model.TocItem
+
+	Preview        bool // 通过预览链接打开
+	PreviewExpires time.Time
 }
 
+// postSID 解析地址中的 SID 或 slug, slug 对应的 SID 缓存在 lookups 中
+func postSID(key string) (int, bool) {
+	if sid, err := strconv.Atoi(key); err == nil {
+		return sid, true
+	}
+	sid := cache.Remember(lookups, "slug:"+key, func() int {
+		var post model.Post
+		invoker.DB.Model(model.Post{}).Select("sid").Where("slug = ?", key).Limit(1).Find(&post)
+		return post.SID
+	})
+	return sid, sid != 0
+}
+
+// PostDetail 处理 /posts/:sid 和 /:year/:month/:slug, :sid 可以是 SID 或 slug,
+// 不是 site.permalink 对应的地址时 301 跳转, 找不到文章时按 aliases 中的旧地址跳转
 func PostDetail(c *gin.Context) {
-	sid := c.Param("sid")
-	if sid == "" {
-		c.AbortWithStatus(http.StatusNotFound)
+	key := c.Param("sid")
+	if key == "" {
+		if _, err := strconv.Atoi(c.Param("year") + c.Param("month")); err != nil {
+			NotFound(c)
+			return
+		}
+		key = c.Param("slug")
+	}
+	sid, ok := postSID(key)
+	if !ok {
+		NotFound(c)
 		return
 	}
-	var post model.Post
-	err := invoker.DB.Model(model.Post{}).Where("sid = ?", sid).First(&post).Error
-	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
+	// 带 preview 参数时必须是有效的预览链接, 可以查看未发布的文章
+	token := c.Query("preview")
+	var expires time.Time
+	if token != "" {
+		var ok bool
+		if expires, ok = verifyPreview(sid, token); !ok {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	} else if data, ok := pages.Get(postCacheKey(sid)); ok {
+		renderPostDetail(c, data.(PostDetailData))
 		return
 	}
-	comments := make([]model.Comment, 0)
-	invoker.DB.Model(model.Comment{}).Where("post_id = ?", post.ID).Order("pub_date DESC").Find(&comments)
-
-	c.HTML(http.StatusOK, "detail.tmpl", PostDetailData{Post: post, Comments: comments, Content: template.HTML(post.Content)})
-}
 
-func LikePost(c *gin.Context) {
-	sid := c.Param("sid")
-	if sid == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		return
+	query := invoker.DB.Model(model.Post{}).Where("sid = ?", sid)
+	if token == "" {
+		query = query.Scopes(model.Live())
 	}
 	var post model.Post
-	err := invoker.DB.Model(model.Post{}).Where("sid = ?", sid).First(&post).Error
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if err := query.First(&post).Error; err != nil {
+		NotFound(c)
 		return
 	}
+	data := PostDetailData{Post: post, Comments: commentTree(post), Content: template.HTML(post.Content), Toc: view.PostToc(post)}
+	if token != "" {
+		data.Preview = true
+		data.PreviewExpires = expires
+		c.Header("Cache-Control", "private, no-store")
+		c.Header("X-Robots-Tag", "noindex")
+	} else {
+		pages.Set(postCacheKey(sid), data)
+	}
+	renderPostDetail(c, data)
+}
 
-	post.LikesCount += 1
-	invoker.DB.Updates(&post)
-	c.JSON(http.StatusOK, gin.H{"msg": "success"})
+// renderPostDetail 旧的 SID 地址、改过的 slug 或日期等非规范地址跳转到规范地址, 预览链接不跳转
+func renderPostDetail(c *gin.Context, data PostDetailData) {
+	if !data.Preview {
+		path := config.Cfg.Site.Prefix + data.Post.Path()
+		if canonical, err := url.PathUnescape(path); err == nil && canonical != c.Request.URL.Path {
+			if query := c.Request.URL.RawQuery; query != "" {
+				path += "?" + query
+			}
+			c.Redirect(http.StatusMovedPermanently, path)
+			return
+		}
+	}
+	c.HTML(http.StatusOK, "detail.tmpl", data)
 }
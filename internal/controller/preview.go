@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"fmt"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/sign"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPreviewTTL = 24 * time.Hour
+	maxPreviewTTL     = 30 * 24 * time.Hour
+)
+
+// previewToken 预览链接中的 preview 参数, 格式为 过期时间戳.签名
+func previewToken(sid int, expires time.Time) string {
+	exp := expires.Unix()
+	return fmt.Sprintf("%d.%s", exp, sign.Sign(fmt.Sprintf("preview:%d:%d", sid, exp)))
+}
+
+// verifyPreview 校验签名并返回过期时间, 签名密钥不可用时拒绝所有预览链接
+func verifyPreview(sid int, token string) (time.Time, bool) {
+	if sign.Init() != nil {
+		return time.Time{}, false
+	}
+	expStr, signature, ok := strings.Cut(token, ".")
+	if !ok || signature == "" {
+		return time.Time{}, false
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return time.Time{}, false
+	}
+	if !sign.Verify(fmt.Sprintf("preview:%d:%d", sid, exp), signature) {
+		return time.Time{}, false
+	}
+	return time.Unix(exp, 0), true
+}
+
+type adminPreviewRequest struct {
+	TTL string `json:"ttl"` // 如 2h, 72h, 默认 24h, 最长 30 天
+}
+
+// AdminPreviewPost 生成带签名的预览链接, 未发布的文章也可以通过该链接查看
+func AdminPreviewPost(c *gin.Context) {
+	if err := sign.Init(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("signing secret unavailable: %v", err)})
+		return
+	}
+	post, ok := findAdminPost(c, false)
+	if !ok {
+		return
+	}
+	var req adminPreviewRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ttl := defaultPreviewTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > maxPreviewTTL {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a duration between 1s and 720h"})
+			return
+		}
+		ttl = d
+	}
+	expires := time.Now().Add(ttl)
+	c.JSON(http.StatusOK, gin.H{
+		"url":        config.Cfg.Site.AbsURL(fmt.Sprintf("/posts/%d?preview=%s", post.SID, previewToken(post.SID, expires))),
+		"expires_at": time.Unix(expires.Unix(), 0),
+	})
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"lazyblog/internal/cache"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// aliasPath 把 aliases 中的地址规范为解码后的路径: 可以是完整的 URL, 去掉查询参数和末尾的 /,
+// 无效的地址和根路径返回空字符串
+func aliasPath(alias string) string {
+	alias = strings.TrimSpace(alias)
+	if alias == "" {
+		return ""
+	}
+	u, err := url.Parse(alias)
+	if err != nil {
+		return ""
+	}
+	p := path.Clean("/" + u.Path)
+	if p == "/" {
+		return ""
+	}
+	return p
+}
+
+// saveAliases 记录跳转到文章的旧地址, 已指向其他文章的地址改为指向这篇文章.
+// 只增加不删除, front-matter 中去掉的地址继续跳转
+func saveAliases(db *gorm.DB, post model.Post, aliases []string) error {
+	for _, alias := range aliases {
+		p := aliasPath(alias)
+		if p == "" {
+			continue
+		}
+		err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "path"}},
+			DoUpdates: clause.AssignmentColumns([]string{"post_id", "updated_at"}),
+		}).Create(&model.Redirect{Path: p, PostID: post.ID}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepOldPath 文章地址因 slug 或发布日期改变时把旧地址记录为跳转, 已经公开的链接继续有效.
+// 草稿也记录, 跳转只对读者可见的文章生效
+func keepOldPath(db *gorm.DB, before, after model.Post) error {
+	if before.Slug == "" || before.Path() == after.Path() {
+		return nil
+	}
+	return saveAliases(db, after, []string{config.Cfg.Site.Prefix + before.Path()})
+}
+
+// aliasTarget 按旧地址查找文章, 返回文章的规范地址, 文章对读者不可见时返回 false.
+// 结果缓存在 lookups 中, 找不到时也缓存, 以免不存在的地址每次都查询数据库;
+// 文章和 aliases 变化时缓存会被清空
+func aliasTarget(p string) (string, bool) {
+	p = aliasPath(p)
+	if p == "" {
+		return "", false
+	}
+	target := cache.Remember(lookups, "alias:"+p, func() string {
+		var redirect model.Redirect
+		if err := invoker.DB.Model(model.Redirect{}).Where("path = ?", p).Limit(1).Find(&redirect).Error; err != nil || redirect.ID == 0 {
+			return ""
+		}
+		var post model.Post
+		if err := invoker.DB.Model(model.Post{}).Scopes(model.Live()).Where("id = ?", redirect.PostID).First(&post).Error; err != nil {
+			return ""
+		}
+		return config.Cfg.Site.Prefix + post.Path()
+	})
+	return target, target != ""
+}
+
+// NotFound 旧地址 301 跳转到对应的文章, 其他地址返回 404
+func NotFound(c *gin.Context) {
+	if target, ok := aliasTarget(c.Request.URL.Path); ok {
+		c.Redirect(http.StatusMovedPermanently, target)
+		return
+	}
+	c.String(http.StatusNotFound, "404 page not found")
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"lazyblog/internal/cache"
+	"lazyblog/internal/diff"
+	"lazyblog/internal/model"
+	"lazyblog/internal/schedule"
+	"lazyblog/internal/search"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+type revisionItem struct {
+	Number    int       `json:"number"`
+	Action    string    `json:"action"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newRevisionItem(rev model.Revision) revisionItem {
+	return revisionItem{
+		Number:    rev.Number,
+		Action:    rev.Action,
+		Title:     rev.Title,
+		Author:    rev.Author,
+		CreatedAt: rev.CreatedAt,
+	}
+}
+
+// maxRevisionAttempts 同时修改同一篇文章时版本号冲突最多尝试的次数
+const maxRevisionAttempts = 5
+
+// saveRevision 记录文章当前的 front-matter 和 markdown, 与最新版本相同时不重复记录.
+// 版本号为最新版本加一, 同时保存时唯一索引冲突, 在 savepoint 中重新读取最新版本后重试
+func saveRevision(db *gorm.DB, post model.Post, action string) error {
+	frontMatter, err := yaml.Marshal(postToBlog(post))
+	if err != nil {
+		return err
+	}
+	author := post.Author
+	if author == "" {
+		author = config.Cfg.Site.Author
+	}
+	for range maxRevisionAttempts {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var last model.Revision
+			if err := tx.Model(model.Revision{}).Where("post_id = ?", post.ID).Order("number DESC").Limit(1).Find(&last).Error; err != nil {
+				return err
+			}
+			if last.ID != 0 && last.FrontMatter == string(frontMatter) && last.Markdown == post.Markdown {
+				return nil
+			}
+			return tx.Create(&model.Revision{
+				PostID:      post.ID,
+				Number:      last.Number + 1,
+				Action:      action,
+				Title:       post.Title,
+				Author:      author,
+				FrontMatter: string(frontMatter),
+				Markdown:    post.Markdown,
+			}).Error
+		})
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+	}
+	// 不再包装 ErrDuplicatedKey, 以免被当作 slug 冲突报告
+	return fmt.Errorf("save revision of post %d: %v", post.SID, err)
+}
+
+// saveEdit 在一个事务中保存修改后的文章和旧地址, 修改前后的内容各记录为一个版本,
+// 任何一步失败时文章不会被修改
+func saveEdit(db *gorm.DB, before model.Post, post *model.Post, action string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 旧数据可能还没有历史版本, 覆盖前先记录当前内容
+		if err := saveRevision(tx, before, "snapshot"); err != nil {
+			return err
+		}
+		if err := tx.Save(post).Error; err != nil {
+			return err
+		}
+		if err := keepOldPath(tx, before, *post); err != nil {
+			return err
+		}
+		return saveRevision(tx, *post, action)
+	})
+}
+
+// findRevision 按版本号查找文章的历史版本
+func findRevision(c *gin.Context, post *model.Post, number string) (*model.Revision, bool) {
+	var rev model.Revision
+	err := invoker.DB.Model(model.Revision{}).Where("post_id = ? AND number = ?", post.ID, cast.ToInt(number)).First(&rev).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return nil, false
+	}
+	return &rev, true
+}
+
+// AdminListRevisions 按版本号倒序列出文章的历史版本
+func AdminListRevisions(c *gin.Context) {
+	post, ok := findAdminPost(c, true)
+	if !ok {
+		return
+	}
+	revisions := make([]model.Revision, 0)
+	invoker.DB.Model(model.Revision{}).Where("post_id = ?", post.ID).Order("number DESC").Find(&revisions)
+	items := make([]revisionItem, 0, len(revisions))
+	for _, rev := range revisions {
+		items = append(items, newRevisionItem(rev))
+	}
+	c.JSON(http.StatusOK, gin.H{"sid": post.SID, "revisions": items})
+}
+
+// AdminGetRevision 返回历史版本的 front-matter 和 markdown
+func AdminGetRevision(c *gin.Context) {
+	post, ok := findAdminPost(c, true)
+	if !ok {
+		return
+	}
+	rev, ok := findRevision(c, post, c.Param("rev"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"revision":     newRevisionItem(*rev),
+		"front_matter": rev.FrontMatter,
+		"markdown":     rev.Markdown,
+		"source":       formatSource(rev.FrontMatter, rev.Markdown),
+	})
+}
+
+// AdminDiffRevisions 比较两个历史版本, 省略 to 时与文章的当前内容比较
+func AdminDiffRevisions(c *gin.Context) {
+	post, ok := findAdminPost(c, true)
+	if !ok {
+		return
+	}
+	if c.Query("from") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+	from, ok := findRevision(c, post, c.Query("from"))
+	if !ok {
+		return
+	}
+	fromName := fmt.Sprintf("posts/%d@%d", post.SID, from.Number)
+	fromSource := formatSource(from.FrontMatter, from.Markdown)
+
+	toName := fmt.Sprintf("posts/%d", post.SID)
+	var toSource string
+	if c.Query("to") == "" {
+		source, err := postSource(*post)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		toSource = source
+	} else {
+		to, ok := findRevision(c, post, c.Query("to"))
+		if !ok {
+			return
+		}
+		toName = fmt.Sprintf("posts/%d@%d", post.SID, to.Number)
+		toSource = formatSource(to.FrontMatter, to.Markdown)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from": fromName,
+		"to":   toName,
+		"diff": diff.Unified(fromName, toName, fromSource, toSource, cast.ToInt(c.DefaultQuery("context", "3"))),
+	})
+}
+
+// AdminRollbackPost 用历史版本的 front-matter 和 markdown 覆盖文章并重新渲染, 保留当前的发布状态.
+// 回滚本身也记录为一个新版本, 可以再回滚回来
+func AdminRollbackPost(c *gin.Context) {
+	post, ok := findAdminPost(c, false)
+	if !ok {
+		return
+	}
+	rev, ok := findRevision(c, post, c.Param("rev"))
+	if !ok {
+		return
+	}
+	b := &blog{}
+	if err := yaml.Unmarshal([]byte(rev.FrontMatter), b); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("invalid revision front-matter: %v", err)})
+		return
+	}
+	b.Markdown = rev.Markdown
+	b.Published = post.Published
+
+	before := *post
+	if err := applyBlog(invoker.DB, post, b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := saveEdit(invoker.DB, before, post, fmt.Sprintf("rollback to %d", rev.Number)); err != nil {
+		saveFailed(c, *post, err)
+		return
+	}
+	search.Index(*post)
+	cache.PurgeAll()
+	schedule.Reschedule()
+	c.JSON(http.StatusOK, gin.H{"message": "post rolled back successfully", "revision": rev.Number, "post": newAdminPostItem(*post)})
+}
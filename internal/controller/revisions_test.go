@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"errors"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "controller")
+	if err != nil {
+		panic(err)
+	}
+	config.Cfg.Database.Driver = "sqlite"
+	config.Cfg.Database.Path = filepath.Join(dir, "test.db")
+	invoker.Init()
+	invoker.DB.Logger = logger.Discard
+	if err := invoker.DB.AutoMigrate(model.Post{}, model.Revision{}, model.Redirect{}); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func reset(t *testing.T) {
+	t.Helper()
+	invoker.DB.Exec("DELETE FROM posts")
+	invoker.DB.Exec("DELETE FROM revisions")
+	invoker.DB.Exec("DELETE FROM redirects")
+}
+
+// conflictRevisions 之后 n 次插入版本前先插入同一版本号的记录, 模拟同时保存的另一个请求
+func conflictRevisions(t *testing.T, n int) {
+	t.Helper()
+	name := "test:conflict_revisions"
+	err := invoker.DB.Callback().Create().Before("gorm:create").Register(name, func(db *gorm.DB) {
+		rev, ok := db.Statement.Dest.(*model.Revision)
+		if !ok || n == 0 {
+			return
+		}
+		n--
+		_, err := db.Statement.ConnPool.ExecContext(db.Statement.Context,
+			"INSERT INTO revisions (post_id, number, action) VALUES (?, ?, 'other')", rev.PostID, rev.Number)
+		if err != nil {
+			db.AddError(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { invoker.DB.Callback().Create().Remove(name) })
+}
+
+func newTestPost(t *testing.T, slug string) model.Post {
+	t.Helper()
+	post := model.Post{Title: "Hello", Slug: slug, Markdown: "first"}
+	if err := createPost(invoker.DB, &post); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func revisionActions(postID int) []string {
+	var revisions []model.Revision
+	invoker.DB.Where("post_id = ?", postID).Order("number").Find(&revisions)
+	actions := make([]string, 0, len(revisions))
+	for _, rev := range revisions {
+		actions = append(actions, rev.Action)
+	}
+	return actions
+}
+
+func TestSaveRevisionRetry(t *testing.T) {
+	reset(t)
+	post := newTestPost(t, "retry")
+	conflictRevisions(t, 2)
+	if err := saveRevision(invoker.DB, post, "edit"); err != nil {
+		t.Fatalf("saveRevision: %v", err)
+	}
+	if actions := revisionActions(post.ID); len(actions) != 1 || actions[0] != "edit" {
+		t.Errorf("revisions = %v, want [edit]", actions)
+	}
+}
+
+func TestSaveEditRollsBack(t *testing.T) {
+	reset(t)
+	post := newTestPost(t, "old-slug")
+	before := post
+	post.Slug = "new-slug"
+	post.Markdown = "second"
+	conflictRevisions(t, maxRevisionAttempts*2)
+
+	err := saveEdit(invoker.DB, before, &post, "edit")
+	if err == nil {
+		t.Fatal("saveEdit succeeded although every revision conflicted")
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Errorf("error %v would be reported as a slug conflict", err)
+	}
+	var saved model.Post
+	invoker.DB.Where("id = ?", post.ID).First(&saved)
+	if saved.Slug != "old-slug" || saved.Markdown != "first" {
+		t.Errorf("post saved as %q/%q, want the edit rolled back", saved.Slug, saved.Markdown)
+	}
+	if actions := revisionActions(post.ID); len(actions) != 0 {
+		t.Errorf("revisions = %v, want none", actions)
+	}
+	var redirects int64
+	invoker.DB.Model(model.Redirect{}).Count(&redirects)
+	if redirects != 0 {
+		t.Errorf("%d redirects saved, want none", redirects)
+	}
+}
@@ -0,0 +1,11 @@
+package controller
+
+import (
+	"lazyblog/pkg/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RSSFeed(c *gin.Context) {
+	renderFeedTemplate(c, "rss.tmpl", "application/rss+xml; charset=utf-8", loadFeed(config.Cfg.Site.Title, "/", "/rss.xml"))
+}
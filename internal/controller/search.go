@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"lazyblog/internal/search"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+)
+
+type SearchData struct {
+	Title     string
+	Query     string
+	Results   []search.Result
+	Total     int
+	Page      int
+	Size      int
+	TotalPage int
+	BaseURL   string // 分页链接的前缀, 包含 q 和 size 参数
+}
+
+func Search(c *gin.Context) {
+	pageStr := c.Query("page")
+	page := cast.ToInt(pageStr)
+	if page <= 0 {
+		page = 1
+	}
+	sizeStr := c.Query("size")
+	size := cast.ToInt(sizeStr)
+	if size <= 0 {
+		size = 10
+	}
+	q := strings.TrimSpace(c.Query("q"))
+
+	results, total := search.Search(q, page, size)
+	baseURL := "/search?q=" + url.QueryEscape(q)
+	if sizeStr != "" {
+		baseURL += "&size=" + strconv.Itoa(size)
+	}
+
+	totalPage := total / size
+	if total%size != 0 {
+		totalPage += 1
+	}
+	c.HTML(http.StatusOK, "search.tmpl", SearchData{
+		Title:     "搜索",
+		Query:     q,
+		Results:   results,
+		Total:     total,
+		Page:      page,
+		Size:      size,
+		TotalPage: totalPage,
+		BaseURL:   baseURL,
+	})
+}
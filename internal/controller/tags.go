@@ -21,7 +21,7 @@ type ListTagsData struct {
 func ListTags(c *gin.Context) {
 	results := make([]ListTagsItem, 0)
 	tags := make([]string, 0)
-	invoker.DB.Model(model.Post{}).Select("tags").Where("published = ?", true).Find(&tags)
+	invoker.DB.Model(model.Post{}).Select("tags").Scopes(model.Live()).Find(&tags)
 	tagCountMap := make(map[string]int64)
 	for _, tagStr := range tags {
 		tagList := model.ParseTags(tagStr)
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"lazyblog/internal/model"
+	"lazyblog/internal/notify"
+	"lazyblog/pkg/invoker"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Unsubscribe(c *gin.Context) {
+	email := strings.ToLower(c.Query("email"))
+	if email == "" || !notify.VerifyUnsubscribe(email, c.Query("token")) {
+		c.HTML(http.StatusBadRequest, "unsubscribe.tmpl", gin.H{
+			"Title":   "退订失败",
+			"Message": "退订链接无效或已损坏",
+		})
+		return
+	}
+	invoker.DB.Where(model.Unsubscribe{Email: email}).FirstOrCreate(&model.Unsubscribe{})
+	c.HTML(http.StatusOK, "unsubscribe.tmpl", gin.H{
+		"Title":   "退订成功",
+		"Message": email + " 将不再收到评论通知邮件",
+	})
+}
@@ -0,0 +1,157 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"lazyblog/pkg/config"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var running bool
+
+// Running 导出过程中为 true, 模板据此隐藏评论、点赞、搜索等动态功能
+func Running() bool {
+	return running
+}
+
+// 没有被任何页面链接到, 但也需要导出的地址
+var seeds = []string{"/", "/posts", "/tags", "/categories", "/archive", "/about", "/atom.xml", "/rss.xml", "/feed.json"}
+
+// 导出时跳过的动态地址
+var skipped = []string{"/static/", "/search", "/unsubscribe"}
+
+var linkPattern = regexp.MustCompile(`(?:href|src)="([^"]+)"`)
+
+// Run 在进程内请求 handler, 从 seeds 出发沿站内链接把所有公开页面写到 dir,
+// 保留 site.prefix 作为目录层级, 并复制 ./static
+func Run(handler http.Handler, dir string) error {
+	running = true
+	defer func() { running = false }()
+
+	prefix := config.Cfg.Site.Prefix
+	queue := make([]string, 0, len(seeds))
+	seen := make(map[string]bool)
+	for _, seed := range seeds {
+		queue = append(queue, prefix+seed)
+		seen[prefix+seed] = true
+	}
+
+	count := 0
+	for len(queue) > 0 {
+		target := queue[0]
+		queue = queue[1:]
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			log.Printf("export: skip %s, status %d", target, w.Code)
+			continue
+		}
+		body := w.Body.Bytes()
+		file, err := outputFile(dir, target)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, body, 0644); err != nil {
+			return err
+		}
+		count++
+
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			continue
+		}
+		for _, match := range linkPattern.FindAllSubmatch(body, -1) {
+			link, ok := internalLink(prefix, html.UnescapeString(string(match[1])))
+			if ok && !seen[link] {
+				seen[link] = true
+				queue = append(queue, link)
+			}
+		}
+	}
+
+	if err := copyDir("static", filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(prefix, "/")), "static")); err != nil {
+		return fmt.Errorf("copy static error: %w", err)
+	}
+	log.Printf("export: wrote %d pages to %s", count, dir)
+	return nil
+}
+
+// internalLink 只保留 prefix 下不带查询参数的站内链接
+func internalLink(prefix, link string) (string, bool) {
+	if i := strings.IndexByte(link, '#'); i >= 0 {
+		link = link[:i]
+	}
+	if link == "" || strings.HasPrefix(link, "//") || strings.Contains(link, "?") || !strings.HasPrefix(link, "/") {
+		return "", false
+	}
+	if link != prefix && !strings.HasPrefix(link, prefix+"/") {
+		return "", false
+	}
+	for _, skip := range skipped {
+		if strings.HasPrefix(link, prefix+skip) {
+			return "", false
+		}
+	}
+	return link, true
+}
+
+// outputFile /posts/1 写到 posts/1/index.html, feed 等带扩展名的地址原样写入
+func outputFile(dir, target string) (string, error) {
+	p, err := url.PathUnescape(target)
+	if err != nil {
+		return "", err
+	}
+	p = path.Clean("/" + p)
+	switch path.Ext(p) {
+	case ".xml", ".json":
+	default:
+		p = path.Join(p, "index.html")
+	}
+	return filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(p, "/"))), nil
+}
+
+func copyDir(src, dst string) error {
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
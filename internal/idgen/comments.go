@@ -0,0 +1,44 @@
+package idgen
+
+import (
+	"lazyblog/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// DedupComments 在 AutoMigrate 为 comments.sid 建立唯一索引之前调用. 旧版本的 SID 为秒数加随机数, 可能重复:
+// 重复时保留最早的评论, 其余的换成新的 SID, 其他文章下回复它们的评论随之修改
+// (同一文章下无法区分回复的是哪一条, 仍指向最早的评论), 返回修改的评论数
+func DedupComments(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&model.Comment{}) {
+		return 0, nil
+	}
+	duplicates := make([]int, 0)
+	if err := db.Unscoped().Model(model.Comment{}).Group("sid").Having("COUNT(*) > 1").Pluck("sid", &duplicates).Error; err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, sid := range duplicates {
+		same := make([]model.Comment, 0)
+		if err := db.Unscoped().Model(model.Comment{}).Where("sid = ?", sid).Order("id").Find(&same).Error; err != nil {
+			return n, err
+		}
+		for _, comment := range same[1:] {
+			next := Next()
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Unscoped().Model(model.Comment{}).Where("id = ?", comment.ID).UpdateColumn("sid", next).Error; err != nil {
+					return err
+				}
+				if comment.PostSID == same[0].PostSID {
+					return nil
+				}
+				return tx.Unscoped().Model(model.Comment{}).Where("parent_sid = ? AND post_sid = ?", sid, comment.PostSID).UpdateColumn("parent_sid", next).Error
+			})
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
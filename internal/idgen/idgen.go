@@ -0,0 +1,57 @@
+package idgen
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 新的 SID = 自 2006-01-02 15:04:05 UTC 起的毫秒数 * 1000 + 序号, 目前约 6.6e14.
+// 旧的 SID 为秒数 * 100 + 随机数, 约 6.6e10, 两者不会重叠, 旧地址继续有效;
+// 2^53 以内可以在浏览器端的 JSON 中精确表示, 足够使用两百多年
+const seqPerMilli = 1000
+
+// maxAttempts 插入时遇到唯一约束冲突最多尝试的次数
+const maxAttempts = 5
+
+var epoch = time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+var (
+	mu   sync.Mutex
+	last int
+)
+
+// Next 返回进程内严格递增的 SID, 同一进程内不会重复.
+// 每毫秒的第一个序号从随机值开始, 降低多个进程同时生成时冲突的概率;
+// 同一毫秒内的序号用完或时钟回拨时在上一个 SID 的基础上递增
+func Next() int {
+	mu.Lock()
+	defer mu.Unlock()
+	now := int(time.Since(epoch).Milliseconds()) * seqPerMilli
+	next := last + 1
+	if now > last {
+		next = now + rand.Intn(seqPerMilli/2)
+	}
+	last = next
+	return next
+}
+
+// Create 通过 assign 为 value 分配 SID 后插入, 与其他进程生成的 SID 冲突
+// (唯一约束返回 gorm.ErrDuplicatedKey)时换一个 SID 重试.
+// 每次插入在嵌套事务中进行, db 是事务时使用 savepoint, 冲突不会使 postgres 中止整个事务
+func Create(db *gorm.DB, value any, assign func(sid int)) error {
+	var err error
+	for range maxAttempts {
+		assign(Next())
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(value).Error
+		})
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package idgen
+
+import (
+	"fmt"
+	"lazyblog/internal/model"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openDB 打开临时的 sqlite 数据库, 与 invoker.Init 一样把唯一约束错误转换为 gorm.ErrDuplicatedKey
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(10000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(model.Post{}, model.Comment{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestNextConcurrent(t *testing.T) {
+	const workers, perWorker = 50, 200
+	results := make([][]int, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				results[w] = append(results[w], Next())
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool, workers*perWorker)
+	for _, sids := range results {
+		for i, sid := range sids {
+			if i > 0 && sid <= sids[i-1] {
+				t.Fatalf("Next returned %d after %d", sid, sids[i-1])
+			}
+			if seen[sid] {
+				t.Fatalf("Next returned %d twice", sid)
+			}
+			seen[sid] = true
+		}
+	}
+}
+
+func TestCreateConcurrent(t *testing.T) {
+	db := openDB(t)
+	const workers, perWorker = 20, 10
+	errs := make(chan error, workers*perWorker*2)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWorker {
+				post := model.Post{Slug: fmt.Sprintf("post-%d-%d", w, i), Title: "t"}
+				errs <- Create(db, &post, func(sid int) { post.SID = sid })
+				comment := model.Comment{PostSID: post.SID, Content: "c"}
+				errs <- Create(db, &comment, func(sid int) { comment.SID = sid })
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, table := range []any{model.Post{}, model.Comment{}} {
+		var total, distinct int64
+		db.Model(table).Count(&total)
+		db.Model(table).Distinct("sid").Count(&distinct)
+		if total != workers*perWorker || distinct != total {
+			t.Errorf("%T: %d rows with %d distinct sids, want %d", table, total, distinct, workers*perWorker)
+		}
+	}
+}
+
+func TestCreateRetry(t *testing.T) {
+	for _, inTx := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tx=%v", inTx), func(t *testing.T) {
+			db := openDB(t)
+			taken := Next()
+			if err := db.Create(&model.Comment{SID: taken, Content: "existing"}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			// 第一次使用已存在的 SID, 模拟与其他进程生成的 SID 冲突
+			create := func(db *gorm.DB) (model.Comment, int, error) {
+				comment := model.Comment{Content: "new"}
+				attempts := 0
+				err := Create(db, &comment, func(sid int) {
+					attempts++
+					if attempts == 1 {
+						sid = taken
+					}
+					comment.SID = sid
+				})
+				return comment, attempts, err
+			}
+			var comment model.Comment
+			var attempts int
+			var err error
+			if inTx {
+				// 事务中冲突后回滚到 savepoint, 事务仍可继续使用
+				err = db.Transaction(func(tx *gorm.DB) error {
+					if comment, attempts, err = create(tx); err != nil {
+						return err
+					}
+					return tx.Create(&model.Comment{SID: Next(), Content: "after"}).Error
+				})
+			} else {
+				comment, attempts, err = create(db)
+			}
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			if attempts != 2 {
+				t.Errorf("assign called %d times, want 2", attempts)
+			}
+			if comment.SID == taken {
+				t.Errorf("comment saved with the taken sid %d", taken)
+			}
+			var count int64
+			db.Model(model.Comment{}).Where("sid = ?", comment.SID).Count(&count)
+			if count != 1 {
+				t.Errorf("comment %d not saved", comment.SID)
+			}
+		})
+	}
+}
+
+func TestDedupComments(t *testing.T) {
+	db := openDB(t)
+	// 旧版本没有唯一索引
+	if err := db.Migrator().DropIndex(&model.Comment{}, "SID"); err != nil {
+		t.Fatal(err)
+	}
+	comments := []model.Comment{
+		{SID: 1, PostSID: 10, Content: "first"},
+		{SID: 1, PostSID: 20, Content: "same sid on another post"},
+		{SID: 2, PostSID: 10, ParentSID: 1, Content: "reply to first"},
+		{SID: 3, PostSID: 20, ParentSID: 1, Content: "reply to the other"},
+	}
+	if err := db.Create(&comments).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := DedupComments(db)
+	if err != nil || n != 1 {
+		t.Fatalf("DedupComments = %d, %v, want 1", n, err)
+	}
+	if err := db.AutoMigrate(model.Comment{}); err != nil {
+		t.Fatalf("unique index: %v", err)
+	}
+	var other model.Comment
+	db.Where("id = ?", comments[1].ID).First(&other)
+	if other.SID == 1 {
+		t.Fatal("duplicate sid not reassigned")
+	}
+	var replies []model.Comment
+	db.Where("parent_sid <> 0").Order("sid").Find(&replies)
+	if len(replies) != 2 || replies[0].ParentSID != 1 || replies[1].ParentSID != other.SID {
+		t.Errorf("replies point to %+v, want 1 and %d", replies, other.SID)
+	}
+}
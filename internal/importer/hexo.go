@@ -0,0 +1,133 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"lazyblog/internal/slug"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// hexo 的标签插件 {% asset_img a.png 标题 %}, 转换为 markdown 图片以便上传
+var assetImg = regexp.MustCompile(`\{%\s*asset_img\s+(\S+)\s*(.*?)\s*%\}`)
+
+// loadHexo 读取 source/_posts 和 source/_drafts, 草稿导入为未发布.
+// 文件名为 _posts/<相对路径>, 图片为相对 source 的路径, 与 hexo 生成的地址一致
+func loadHexo(dir string) ([]File, error) {
+	cfg, err := readConfig(filepath.Join(dir, "_config.yml"), filepath.Join(dir, "_config.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	permalink := first(cfg, "permalink")
+	if permalink == "" {
+		permalink = ":year/:month/:day/:title/"
+	}
+	root := first(cfg, "root")
+	defaultCategory := first(cfg, "default_category")
+	if defaultCategory == "" {
+		defaultCategory = "uncategorized"
+	}
+	loc := location(first(cfg, "timezone"))
+
+	source := filepath.Join(dir, "source")
+	files := make([]File, 0)
+	for _, folder := range []string{"_posts", "_drafts"} {
+		err := walk(filepath.Join(source, folder), nil, func(name, rel string, info fs.FileInfo) error {
+			if !isMarkdown(name) {
+				return nil
+			}
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			meta, body, err := splitFrontMatter(string(data))
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			title := strings.TrimSuffix(rel, path.Ext(rel))
+			if s := first(meta, "slug"); s != "" {
+				title = s
+			}
+			p := post{
+				Title:       first(meta, "title"),
+				Slug:        path.Base(title),
+				Description: first(meta, "description", "excerpt"),
+				Author:      first(meta, "author"),
+				Published:   boolean(meta["published"], folder == "_posts"),
+				Tags:        strings.Join(strs(meta["tags"], ""), ", "),
+				nameSlug:    first(meta, "slug") == "",
+			}
+			if p.Title == "" {
+				p.Title = basename(name)
+			}
+			var t time.Time
+			if p.PubDate, t, err = pubDate(meta["date"], loc, time.Time{}, info); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			categories := hexoCategories(meta["categories"])
+			if len(categories) > 0 {
+				p.Category = categories[0]
+			}
+
+			// 草稿在 hexo 中还没有地址
+			if folder == "_posts" {
+				vars := dateVars(t)
+				vars["title"] = title
+				vars["name"] = basename(name)
+				vars["post_title"] = slug.Urlize(p.Title)
+				vars["id"] = first(meta, "id")
+				vars["category"] = defaultCategory
+				if len(categories) > 0 {
+					parts := make([]string, 0, len(categories))
+					for _, category := range categories {
+						parts = append(parts, slug.Urlize(category))
+					}
+					vars["category"] = strings.Join(parts, "/")
+				}
+				pattern := permalink
+				if s := first(meta, "permalink"); s != "" {
+					pattern = s
+				}
+				p.Aliases = append(p.Aliases, joinURL(root, expand(pattern, vars)))
+			}
+			for _, alias := range strs(meta["alias"], "") {
+				p.Aliases = append(p.Aliases, joinURL(root, alias))
+			}
+
+			body = assetImg.ReplaceAllStringFunc(body, func(match string) string {
+				m := assetImg.FindStringSubmatch(match)
+				return fmt.Sprintf("![%s](%s)", strings.Trim(m[2], `"'`), m[1])
+			})
+			file, err := p.file(path.Join(folder, rel), body)
+			if err != nil {
+				return err
+			}
+			files = append(files, file)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	assets, err := images(source, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, assets...), nil
+}
+
+// hexoCategories hexo 的 categories 列表表示层级, [A, B] 为 A 下的 B;
+// 嵌套列表 [[A, B], C] 表示多个分类, 只取第一个
+func hexoCategories(v any) []string {
+	if list, ok := v.([]any); ok && len(list) > 0 {
+		if sub, ok := list[0].([]any); ok {
+			return strs(sub, "")
+		}
+	}
+	return strs(v, "")
+}
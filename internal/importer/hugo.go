@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"lazyblog/internal/slug"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// loadHugo 读取 content 下的文章, 跳过 _index.md. 页面包 posts/a/index.md 转换为 content/posts/a.md,
+// 包内的图片通过与文章同名的资源目录找到; static 下的图片去掉 static 前缀, 与 hugo 生成的地址一致
+func loadHugo(dir string) ([]File, error) {
+	names := make([]string, 0)
+	for _, base := range []string{"hugo", "config", filepath.Join("config", "_default", "hugo"), filepath.Join("config", "_default", "config")} {
+		for _, ext := range []string{".toml", ".yaml", ".yml"} {
+			names = append(names, filepath.Join(dir, base+ext))
+		}
+	}
+	cfg, err := readConfig(names...)
+	if err != nil {
+		return nil, err
+	}
+	root := ""
+	if u, err := url.Parse(first(cfg, "baseurl")); err == nil {
+		root = u.Path
+	}
+	permalinks, _ := cfg["permalinks"].(map[string]any)
+	if page, ok := permalinks["page"].(map[string]any); ok {
+		permalinks = page
+	}
+	loc := location(first(cfg, "timezone"))
+
+	files := make([]File, 0)
+	err = walk(filepath.Join(dir, "content"), nil, func(name, rel string, info fs.FileInfo) error {
+		if !isMarkdown(name) || strings.HasPrefix(path.Base(rel), "_index.") {
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		meta, body, err := splitFrontMatter(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		// 页面包以目录名作为文件名
+		rel = strings.TrimSuffix(rel, path.Ext(rel))
+		if path.Base(rel) == "index" {
+			rel = path.Dir(rel)
+		}
+		filename := path.Base(rel)
+		section := ""
+		if i := strings.Index(rel, "/"); i >= 0 {
+			section = rel[:i]
+		}
+
+		p := post{
+			Title:       first(meta, "title"),
+			Slug:        first(meta, "slug"),
+			Description: first(meta, "description", "summary"),
+			Author:      first(meta, "author", "authors"),
+			Published:   !boolean(meta["draft"], false),
+			Tags:        strings.Join(strs(meta["tags"], ""), ", "),
+		}
+		if p.Title == "" {
+			p.Title = filename
+		}
+		published := meta["publishdate"]
+		if published == nil {
+			published = meta["date"]
+		}
+		var t time.Time
+		if p.PubDate, t, err = pubDate(published, loc, time.Time{}, info); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if categories := strs(meta["categories"], ""); len(categories) > 0 {
+			p.Category = categories[0]
+		}
+
+		// hugo 默认的地址为 /<目录>/<slug 或文件名>/, 地址默认转为小写
+		pageURL := first(meta, "url")
+		if pageURL == "" {
+			slugOrName := filename
+			if p.Slug != "" {
+				slugOrName = p.Slug
+			}
+			pageURL = path.Join(path.Dir(rel), slugOrName)
+			if pattern := str(permalinks[strings.ToLower(section)]); pattern != "" {
+				vars := dateVars(t)
+				vars["monthname"] = strings.ToLower(t.Month().String())
+				vars["weekday"] = fmt.Sprint(int(t.Weekday()))
+				vars["weekdayname"] = strings.ToLower(t.Weekday().String())
+				vars["yearday"] = fmt.Sprint(t.YearDay())
+				vars["section"] = section
+				vars["sections"] = path.Dir(rel)
+				vars["title"] = slug.Urlize(p.Title)
+				vars["slug"] = vars["title"]
+				if p.Slug != "" {
+					vars["slug"] = p.Slug
+				}
+				vars["slugorfilename"] = slugOrName
+				vars["filename"] = filename
+				vars["contentbasename"] = filename
+				pageURL = expand(pattern, vars)
+			}
+			pageURL = strings.ToLower(joinURL(root, pageURL))
+		}
+		pageURL = joinURL("", pageURL)
+		p.Aliases = append(p.Aliases, pageURL)
+		// 不以 / 开头的 alias 相对文章所在的目录
+		for _, alias := range strs(meta["aliases"], "") {
+			if !strings.HasPrefix(alias, "/") {
+				alias = path.Join(path.Dir(pageURL), alias)
+			}
+			p.Aliases = append(p.Aliases, joinURL("", alias))
+		}
+		if p.Slug == "" {
+			p.Slug = filename
+			p.nameSlug = true
+		}
+
+		file, err := p.file(path.Join("content", rel+".md"), body)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	static, err := images(filepath.Join(dir, "static"), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := images(filepath.Join(dir, "content"), "content", nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(files, static...), resources...), nil
+}
@@ -0,0 +1,486 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"lazyblog/internal/model"
+	"lazyblog/internal/slug"
+	"lazyblog/pkg/config"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的站点格式
+const (
+	Hexo   = "hexo"
+	Hugo   = "hugo"
+	Jekyll = "jekyll"
+)
+
+// File 转换后的文件, 与 controller.ImportFile 对应. markdown 的 front-matter 已转换为发表接口的格式,
+// 图片按在原站点中的访问路径命名, 以便解析文章中 / 开头的地址
+type File struct {
+	Name string
+	Data []byte
+
+	post *post // markdown 转换后的 front-matter 和正文, 用于修改 slug 后重新生成 Data
+	body string
+}
+
+// post 转换后的 front-matter, 字段与 controller 中的 blog 一致
+type post struct {
+	Title       string   `yaml:"title"`
+	Slug        string   `yaml:"slug,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	Author      string   `yaml:"author,omitempty"`
+	Published   bool     `yaml:"published"`
+	PubDate     string   `yaml:"pubdate,omitempty"`
+	Tags        string   `yaml:"tags,omitempty"`
+	Category    string   `yaml:"category,omitempty"`
+	Aliases     []string `yaml:"aliases,omitempty"` // 原站点的文章地址, 导入后 301 跳转到新地址
+
+	nameSlug bool // slug 取自文件名而不是 front-matter, 重复时可以加后缀
+}
+
+func (p post) file(name, body string) (File, error) {
+	frontMatter, err := yaml.Marshal(p)
+	if err != nil {
+		return File{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return File{Name: name, Data: []byte("---\n" + string(frontMatter) + "---\n\n" + strings.TrimSpace(body) + "\n"), post: &p, body: body}, nil
+}
+
+// dedupeSlugs 不同目录中的同名文件以文件名作为 slug 时会重复, 按文件顺序加上 -2、-3 等后缀;
+// front-matter 中设置的 slug 不修改, 重复时由导入报错
+func dedupeSlugs(files []File) ([]File, error) {
+	used := make(map[string]bool)
+	for _, f := range files {
+		if f.post != nil && !f.post.nameSlug {
+			used[slug.Make(f.post.Slug)] = true
+		}
+	}
+	for i, f := range files {
+		if f.post == nil || !f.post.nameSlug {
+			continue
+		}
+		p := *f.post
+		base := p.Slug
+		for n := 2; used[slug.Make(p.Slug)]; n++ {
+			p.Slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[slug.Make(p.Slug)] = true
+		if p.Slug == base {
+			continue
+		}
+		file, err := p.file(f.Name, f.body)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = file
+	}
+	return files, nil
+}
+
+// Detect 按目录结构识别站点格式: hexo 有 source/_posts, jekyll 有 _posts, hugo 有 content
+func Detect(dir string) (string, error) {
+	switch {
+	case isDir(filepath.Join(dir, "source", "_posts")):
+		return Hexo, nil
+	case isDir(filepath.Join(dir, "_posts")):
+		return Jekyll, nil
+	case isDir(filepath.Join(dir, "content")):
+		return Hugo, nil
+	}
+	return "", fmt.Errorf("%s is not a hexo, hugo or jekyll site", dir)
+}
+
+// Load 读取站点目录中的文章和图片, format 为空时自动识别
+func Load(dir, format string) ([]File, error) {
+	if format == "" {
+		var err error
+		if format, err = Detect(dir); err != nil {
+			return nil, err
+		}
+	}
+	var files []File
+	var err error
+	switch format {
+	case Hexo:
+		files, err = loadHexo(dir)
+	case Hugo:
+		files, err = loadHugo(dir)
+	case Jekyll:
+		files, err = loadJekyll(dir)
+	default:
+		return nil, fmt.Errorf("unsupported format %q, expected hexo, hugo or jekyll", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dedupeSlugs(files)
+}
+
+func isDir(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
+
+func isMarkdown(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// IsImage 按扩展名判断是否为图片
+func IsImage(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg", ".bmp", ".ico", ".avif":
+		return true
+	}
+	return false
+}
+
+// walk 遍历 root 下的文件, 跳过隐藏文件和 node_modules, skip 返回 true 的目录也跳过.
+// fn 的 rel 为相对 root 的 / 分隔路径
+func walk(root string, skip func(rel string) bool, fn func(name, rel string, info fs.FileInfo) error) error {
+	if !isDir(root) {
+		return nil
+	}
+	return filepath.Walk(root, func(name string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		base := info.Name()
+		if info.IsDir() {
+			if strings.HasPrefix(base, ".") || base == "node_modules" || (skip != nil && skip(rel)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(base, ".") {
+			return nil
+		}
+		return fn(name, rel, info)
+	})
+}
+
+// images 读取 root 下的图片, 文件名加上 prefix
+func images(root, prefix string, skip func(rel string) bool) ([]File, error) {
+	files := make([]File, 0)
+	err := walk(root, skip, func(name, rel string, info fs.FileInfo) error {
+		if !IsImage(name) {
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Name: path.Join(prefix, rel), Data: data})
+		return nil
+	})
+	return files, err
+}
+
+// readConfig 读取站点配置, 按扩展名解析 yaml 或 toml, 第一个存在的文件生效, 都不存在时返回空配置
+func readConfig(names ...string) (map[string]any, error) {
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var meta map[string]any
+		if strings.HasSuffix(name, ".toml") {
+			meta, err = parseTOML(string(data))
+		} else {
+			meta, err = parseYAML(string(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return meta, nil
+	}
+	return map[string]any{}, nil
+}
+
+// splitFrontMatter 拆分 front-matter 和正文, 支持 --- 包围的 yaml 和 hugo 的 +++ 包围的 toml,
+// 没有 front-matter 时返回空的 map
+func splitFrontMatter(content string) (map[string]any, string, error) {
+	content = strings.TrimPrefix(strings.ReplaceAll(content, "\r\n", "\n"), "\ufeff")
+	var delim string
+	var parse func(string) (map[string]any, error)
+	switch {
+	case strings.HasPrefix(content, "---\n"):
+		delim, parse = "---", parseYAML
+	case strings.HasPrefix(content, "+++\n"):
+		delim, parse = "+++", parseTOML
+	case strings.HasPrefix(strings.TrimSpace(content), "{"):
+		return nil, "", fmt.Errorf("json front-matter is not supported")
+	default:
+		return map[string]any{}, content, nil
+	}
+	lines := strings.SplitAfter(content[len(delim)+1:], "\n")
+	offset := len(delim) + 1
+	for i, line := range lines {
+		if trimmed := strings.TrimRight(line, " \t\n"); trimmed == delim || (delim == "---" && trimmed == "...") {
+			meta, err := parse(strings.Join(lines[:i], ""))
+			if err != nil {
+				return nil, "", err
+			}
+			return meta, content[offset+len(line):], nil
+		}
+		offset += len(line)
+	}
+	return nil, "", fmt.Errorf("front-matter is not closed by %s", delim)
+}
+
+// parseYAML 标量都保留为原始字符串: yaml.v3 会把不带时区的日期当作 UTC, 需要按原站点的时区解析
+func parseYAML(s string) (map[string]any, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(s), &node); err != nil {
+		return nil, fmt.Errorf("yaml parse error: %w", err)
+	}
+	meta, ok := nodeValue(&node).(map[string]any)
+	if !ok {
+		if node.Kind == 0 || nodeValue(&node) == nil {
+			return map[string]any{}, nil
+		}
+		return nil, fmt.Errorf("front-matter is not a mapping")
+	}
+	return meta, nil
+}
+
+func nodeValue(n *yaml.Node) any {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return nodeValue(n.Content[0])
+	case yaml.AliasNode:
+		return nodeValue(n.Alias)
+	case yaml.SequenceNode:
+		list := make([]any, 0, len(n.Content))
+		for _, item := range n.Content {
+			list = append(list, nodeValue(item))
+		}
+		return list
+	case yaml.MappingNode:
+		m := make(map[string]any, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			m[strings.ToLower(n.Content[i].Value)] = nodeValue(n.Content[i+1])
+		}
+		return m
+	}
+	if n.Tag == "!!null" {
+		return nil
+	}
+	return n.Value
+}
+
+// parseTOML 键统一转为小写, hugo 的 publishDate 等键不区分大小写
+func parseTOML(s string) (map[string]any, error) {
+	meta := make(map[string]any)
+	if err := toml.Unmarshal([]byte(s), &meta); err != nil {
+		return nil, fmt.Errorf("toml parse error: %w", err)
+	}
+	return lowerKeys(meta), nil
+}
+
+func lowerKeys(m map[string]any) map[string]any {
+	lowered := make(map[string]any, len(m))
+	for k, v := range m {
+		if sub, ok := v.(map[string]any); ok {
+			v = lowerKeys(sub)
+		}
+		lowered[strings.ToLower(k)] = v
+	}
+	return lowered
+}
+
+// str 把 front-matter 中的值转为字符串
+func str(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []any:
+		if len(v) > 0 {
+			return str(v[0])
+		}
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
+
+// first 返回第一个非空的字段
+func first(meta map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s := str(meta[key]); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// strs 把列表或用 sep 分隔的字符串转为列表, 嵌套的列表展开, sep 为空时字符串作为一项
+func strs(v any, sep string) []string {
+	list := make([]string, 0)
+	switch v := v.(type) {
+	case nil:
+	case []any:
+		for _, item := range v {
+			list = append(list, strs(item, "")...)
+		}
+	default:
+		s := str(v)
+		parts := []string{s}
+		if sep == " " {
+			parts = strings.Fields(s)
+		} else if sep != "" {
+			parts = strings.Split(s, sep)
+		}
+		for _, part := range parts {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+	}
+	return list
+}
+
+// boolean 解析 true/false, 缺省或无法解析时返回 def
+func boolean(v any, def bool) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+}
+
+// date 解析 front-matter 中的日期, 不带时区时按原站点的时区 loc 解析, 缺省时返回零值
+func date(v any, loc *time.Location) (time.Time, error) {
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	case toml.LocalDateTime:
+		return v.AsTime(loc), nil
+	case toml.LocalDate:
+		return v.AsTime(loc), nil
+	}
+	s := str(v)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// location 原站点配置的时区, 未配置时使用 site.timezone
+func location(name string) *time.Location {
+	if name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return config.Cfg.Site.Location()
+}
+
+// pubDate 文章的发布时间, front-matter 中没有日期时使用 fallback, 再没有时使用文件的修改时间
+func pubDate(v any, loc *time.Location, fallback time.Time, info fs.FileInfo) (string, time.Time, error) {
+	t, err := date(v, loc)
+	if err != nil {
+		return "", t, err
+	}
+	if t.IsZero() {
+		t = fallback
+	}
+	if t.IsZero() {
+		t = info.ModTime()
+	}
+	return model.FormatPubDate(t), t, nil
+}
+
+var placeholder = regexp.MustCompile(`:[a-z_]+`)
+
+// expand 替换 permalink 中的 :year、:title 等占位符, 未知的占位符原样保留
+func expand(pattern string, vars map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(pattern, func(name string) string {
+		if v, ok := vars[name[1:]]; ok {
+			return v
+		}
+		return name
+	})
+}
+
+// dateVars 各格式共用的日期占位符
+func dateVars(t time.Time) map[string]string {
+	return map[string]string{
+		"year":       t.Format("2006"),
+		"short_year": t.Format("06"),
+		"month":      t.Format("01"),
+		"i_month":    strconv.Itoa(int(t.Month())),
+		"day":        t.Format("02"),
+		"i_day":      strconv.Itoa(t.Day()),
+		"hour":       t.Format("15"),
+		"minute":     t.Format("04"),
+		"second":     t.Format("05"),
+	}
+}
+
+// joinURL 拼接站点根路径和文章地址
+func joinURL(root, p string) string {
+	return path.Clean("/" + strings.Trim(root, "/") + "/" + p)
+}
+
+// basename 去掉扩展名的文件名
+func basename(name string) string {
+	base := filepath.Base(name)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
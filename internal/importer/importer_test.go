@@ -0,0 +1,194 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeSite 在临时目录中创建站点, files 的键为 / 分隔的相对路径
+func writeSite(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// converted 转换后 front-matter 中需要检查的字段, pubdate 为空时不检查(取自文件的修改时间)
+type converted struct {
+	pubdate   string
+	slug      string
+	category  string
+	published bool
+	aliases   []string
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		format string
+		site   map[string]string
+		want   map[string]converted
+	}{
+		{
+			format: Hexo,
+			site: map[string]string{
+				"_config.yml": "timezone: Asia/Shanghai\nroot: /blog/\npermalink: :year/:month/:day/:title/\n",
+				"source/_posts/hello-world.md": "---\ntitle: Hello World\ndate: 2020-01-02 10:30:00\n" +
+					"categories:\n  - Tech\n  - Go\nalias: old/hello.html\n---\n\nbody\n",
+				// 不同目录中的同名文件, 由文件名生成的 slug 加上后缀
+				"source/_posts/notes/hello-world.md": "---\ntitle: Notes\ndate: 2021-03-04\n---\n\nbody\n",
+				"source/_drafts/draft.md":            "---\ntitle: Draft\nslug: custom-draft\ndate: 2021-05-06 08:00:00\n---\n\nbody\n",
+				"source/images/a.png":                "png",
+			},
+			want: map[string]converted{
+				"_posts/hello-world.md": {
+					pubdate: "2020-01-02T10:30:00+08:00", slug: "hello-world", category: "Tech", published: true,
+					aliases: []string{"/blog/2020/01/02/hello-world", "/blog/old/hello.html"},
+				},
+				"_posts/notes/hello-world.md": {
+					pubdate: "2021-03-04", slug: "hello-world-2", published: true,
+					aliases: []string{"/blog/2021/03/04/notes/hello-world"},
+				},
+				"_drafts/draft.md": {pubdate: "2021-05-06T08:00:00+08:00", slug: "custom-draft"},
+			},
+		},
+		{
+			format: Hugo,
+			site: map[string]string{
+				"config.toml": "baseURL = \"https://example.com/site/\"\ntimeZone = \"Asia/Shanghai\"\n\n" +
+					"[permalinks]\nposts = \"/:year/:month/:slug/\"\n",
+				"content/posts/_index.md": "---\ntitle: Posts\n---\n",
+				// 页面包, toml front-matter, 带时区的日期转换为站点时区
+				"content/posts/intro/index.md": "+++\ntitle = \"Intro\"\ndate = 2022-05-06T07:08:09Z\n" +
+					"categories = [\"Life\"]\naliases = [\"/old/intro/\", \"legacy\"]\n+++\n\nbody\n",
+				"content/posts/intro/cover.png": "png",
+				"content/docs/intro.md":         "---\ntitle: Docs\ndate: 2022-01-01\n---\n\nbody\n",
+				"content/posts/draft.md":        "---\ntitle: Draft\nslug: my-draft\ndraft: true\npublishDate: 2023-02-03 09:00\ndate: 2023-01-01\n---\n\nbody\n",
+			},
+			want: map[string]converted{
+				// docs 先于 posts 遍历, 保留文件名作为 slug
+				"content/docs/intro.md": {
+					pubdate: "2022-01-01", slug: "intro", published: true,
+					aliases: []string{"/site/docs/intro"},
+				},
+				"content/posts/intro.md": {
+					pubdate: "2022-05-06T15:08:09+08:00", slug: "intro-2", category: "Life", published: true,
+					aliases: []string{"/site/2022/05/intro", "/old/intro", "/site/2022/05/legacy"},
+				},
+				"content/posts/draft.md": {
+					pubdate: "2023-02-03T09:00:00+08:00", slug: "my-draft",
+					aliases: []string{"/site/2023/02/my-draft"},
+				},
+			},
+		},
+		{
+			format: Jekyll,
+			site: map[string]string{
+				"_config.yml": "timezone: Asia/Shanghai\npermalink: pretty\nbaseurl: /j\n",
+				"_posts/2019-07-08-first-post.md": "---\ntitle: First\ncategories: Dev Notes\n" +
+					"redirect_from:\n  - /old.html\n---\n\nbody\n",
+				// front-matter 中的日期优先于文件名中的日期
+				"_posts/2020-01-01-first-post.md": "---\ntitle: First again\ndate: 2020-01-01 12:00:00 +0000\n---\n\nbody\n",
+				"_drafts/idea.md":                 "---\ntitle: Idea\n---\n\nbody\n",
+				"_site/old.png":                   "png",
+			},
+			want: map[string]converted{
+				"_posts/2019-07-08-first-post.md": {
+					pubdate: "2019-07-08", slug: "first-post", category: "Dev", published: true,
+					aliases: []string{"/j/dev/notes/2019/07/08/first-post", "/j/old.html"},
+				},
+				"_posts/2020-01-01-first-post.md": {
+					pubdate: "2020-01-01T20:00:00+08:00", slug: "first-post-2", published: true,
+					aliases: []string{"/j/2020/01/01/first-post"},
+				},
+				"_drafts/idea.md": {slug: "idea"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			dir := writeSite(t, tt.site)
+			format, err := Detect(dir)
+			if err != nil || format != tt.format {
+				t.Fatalf("Detect = %q, %v, want %q", format, err, tt.format)
+			}
+			files, err := Load(dir, "")
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			got := make(map[string]converted)
+			for _, f := range files {
+				if !isMarkdown(f.Name) {
+					continue
+				}
+				meta, body, err := splitFrontMatter(string(f.Data))
+				if err != nil {
+					t.Fatalf("%s: %v", f.Name, err)
+				}
+				if strings.TrimSpace(body) != "body" {
+					t.Errorf("%s: body = %q", f.Name, body)
+				}
+				got[f.Name] = converted{
+					pubdate:   str(meta["pubdate"]),
+					slug:      str(meta["slug"]),
+					category:  str(meta["category"]),
+					published: boolean(meta["published"], false),
+					aliases:   strs(meta["aliases"], ""),
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("converted %d posts, want %d: %v", len(got), len(tt.want), got)
+			}
+			for name, want := range tt.want {
+				c, ok := got[name]
+				if !ok {
+					t.Errorf("%s not converted", name)
+					continue
+				}
+				if want.pubdate == "" {
+					c.pubdate = ""
+				}
+				if len(want.aliases) == 0 {
+					want.aliases = []string{}
+				}
+				if !reflect.DeepEqual(c, want) {
+					t.Errorf("%s:\n got %+v\nwant %+v", name, c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadKeepsExplicitSlugs(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"_posts/2020-01-01-a.md":    "---\ntitle: A\nslug: same\n---\n",
+		"_posts/2020-01-02-b.md":    "---\ntitle: B\nslug: same\n---\n",
+		"_posts/2020-01-03-same.md": "---\ntitle: C\n---\n",
+	})
+	files, err := Load(dir, Jekyll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slugs := make([]string, 0, len(files))
+	for _, f := range files {
+		meta, _, err := splitFrontMatter(string(f.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		slugs = append(slugs, str(meta["slug"]))
+	}
+	// front-matter 中重复的 slug 原样保留, 由导入时报错; 文件名生成的 slug 避开它们
+	if want := []string{"same", "same", "same-2"}; !reflect.DeepEqual(slugs, want) {
+		t.Errorf("slugs = %v, want %v", slugs, want)
+	}
+}
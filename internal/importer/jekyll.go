@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// jekyll 内置的 permalink 风格
+var jekyllStyles = map[string]string{
+	"date":    "/:categories/:year/:month/:day/:title:output_ext",
+	"pretty":  "/:categories/:year/:month/:day/:title/",
+	"ordinal": "/:categories/:year/:y_day/:title:output_ext",
+	"none":    "/:categories/:title:output_ext",
+}
+
+// jekyll 的文章文件名为 YYYY-MM-DD-title.md
+var jekyllName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+// loadJekyll 读取 _posts 和 _drafts, 草稿导入为未发布. 日期和地址中的 :title 取自文件名,
+// front-matter 中的 date、slug 优先; jekyll-redirect-from 的 redirect_from 一并导入为旧地址
+func loadJekyll(dir string) ([]File, error) {
+	cfg, err := readConfig(filepath.Join(dir, "_config.yml"), filepath.Join(dir, "_config.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	permalink := first(cfg, "permalink")
+	if permalink == "" {
+		permalink = "date"
+	}
+	if style, ok := jekyllStyles[permalink]; ok {
+		permalink = style
+	}
+	baseurl := first(cfg, "baseurl")
+	loc := location(first(cfg, "timezone"))
+
+	files := make([]File, 0)
+	for _, folder := range []string{"_posts", "_drafts"} {
+		err := walk(filepath.Join(dir, folder), nil, func(name, rel string, info fs.FileInfo) error {
+			if !isMarkdown(name) {
+				return nil
+			}
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			meta, body, err := splitFrontMatter(string(data))
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			title := basename(name)
+			var fileDate time.Time
+			if m := jekyllName.FindStringSubmatch(title); m != nil {
+				fileDate, _ = time.ParseInLocation("2006-01-02", m[1], loc)
+				title = m[2]
+			}
+			if s := first(meta, "slug"); s != "" {
+				title = s
+			}
+			p := post{
+				Title:       first(meta, "title"),
+				Slug:        title,
+				Description: first(meta, "description", "excerpt"),
+				Author:      first(meta, "author"),
+				Published:   boolean(meta["published"], folder == "_posts"),
+				Tags:        strings.Join(append(strs(meta["tags"], " "), strs(meta["tag"], "")...), ", "),
+				nameSlug:    first(meta, "slug") == "",
+			}
+			if p.Title == "" {
+				p.Title = strings.ReplaceAll(title, "-", " ")
+			}
+			var t time.Time
+			if p.PubDate, t, err = pubDate(meta["date"], loc, fileDate, info); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			categories := append(strs(meta["categories"], " "), strs(meta["category"], "")...)
+			if len(categories) > 0 {
+				p.Category = categories[0]
+			}
+
+			if folder == "_posts" {
+				vars := dateVars(t)
+				vars["title"] = title
+				vars["slug"] = title
+				vars["y_day"] = fmt.Sprintf("%03d", t.YearDay())
+				vars["output_ext"] = ".html"
+				parts := make([]string, 0, len(categories))
+				for _, category := range categories {
+					parts = append(parts, strings.ToLower(category))
+				}
+				vars["categories"] = strings.Join(parts, "/")
+				pattern := permalink
+				if s := first(meta, "permalink"); s != "" {
+					pattern = s
+				}
+				p.Aliases = append(p.Aliases, joinURL(baseurl, expand(pattern, vars)))
+			}
+			for _, alias := range strs(meta["redirect_from"], "") {
+				p.Aliases = append(p.Aliases, joinURL(baseurl, alias))
+			}
+
+			file, err := p.file(path.Join(folder, rel), body)
+			if err != nil {
+				return err
+			}
+			files = append(files, file)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// _site 等以 _ 开头的目录不会原样发布, 不包含文章引用的图片
+	assets, err := images(dir, "", func(rel string) bool {
+		return strings.HasPrefix(rel, "_") || rel == "vendor"
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(files, assets...), nil
+}
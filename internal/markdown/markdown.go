@@ -0,0 +1,112 @@
+package markdown
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/config"
+	"log"
+	"strings"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// md 文章、关于页等所有 markdown 共用, 启动时按 [markdown] 配置创建一次, 可以并发使用
+var md = New(config.Cfg.Markdown)
+
+// 可以通过 markdown.extensions 开启的扩展, GFM 始终开启
+var extensions = map[string]goldmark.Extender{
+	"footnote":        extension.Footnote,
+	"definition_list": extension.DefinitionList,
+	"typographer":     extension.Typographer,
+	"cjk":             extension.CJK,
+}
+
+// New 按配置创建 goldmark 实例
+func New(cfg config.MarkdownConfig) goldmark.Markdown {
+	exts := []goldmark.Extender{
+		extension.GFM,
+		highlighting.NewHighlighting(
+			highlighting.WithStyle(cfg.HighlightStyle),
+			highlighting.WithFormatOptions(
+				chromahtml.WithLineNumbers(cfg.LineNumbers),
+			),
+		),
+		mermaidExtender(cfg),
+	}
+	if cfg.Math {
+		exts = append(exts, &mathExtender{katexURL: cfg.KatexURL})
+	}
+	for _, name := range cfg.Extensions {
+		ext, ok := extensions[strings.ToLower(name)]
+		if !ok {
+			log.Printf("markdown: unknown extension %q, ignored", name)
+			continue
+		}
+		exts = append(exts, ext)
+	}
+
+	rendererOptions := []renderer.Option{html.WithXHTML()}
+	if cfg.HardWraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+	return goldmark.New(
+		goldmark.WithExtensions(exts...),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+		),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+}
+
+// Convert 渲染 markdown 为 HTML
+func Convert(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ConvertWithToc 渲染 markdown, 同时返回从同一棵 AST 中提取的目录
+func ConvertWithToc(source string) (string, []*model.TocItem, error) {
+	src := []byte(source)
+	doc := parse(src)
+	toc := ExtractToc(doc, src)
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, src, doc); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), toc, nil
+}
+
+// RenderPost 将 post.Markdown 渲染到 Content 和 Toc
+func RenderPost(post *model.Post) error {
+	content, toc, err := ConvertWithToc(post.Markdown)
+	if err != nil {
+		return fmt.Errorf("markdown conversion error: %w", err)
+	}
+	post.Content = content
+	tocJson, _ := json.Marshal(toc)
+	post.Toc = string(tocJson)
+	return nil
+}
+
+// Toc 只提取目录, 不渲染
+func Toc(source string) []*model.TocItem {
+	src := []byte(source)
+	return ExtractToc(parse(src), src)
+}
+
+func parse(source []byte) ast.Node {
+	return md.Parser().Parse(text.NewReader(source))
+}
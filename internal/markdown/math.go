@@ -0,0 +1,238 @@
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const defaultKatexURL = "https://cdn.jsdelivr.net/npm/katex@0.16.11/dist"
+
+// MathBlockKind 以单独一行 $$ 开始和结束的公式
+var MathBlockKind = ast.NewNodeKind("MathBlock")
+
+type MathBlock struct {
+	ast.BaseBlock
+	closed bool // $$...$$ 写在同一行时打开即结束
+}
+
+func (*MathBlock) IsRaw() bool                  { return true }
+func (*MathBlock) Kind() ast.NodeKind           { return MathBlockKind }
+func (n *MathBlock) Dump(src []byte, level int) { ast.DumpHelper(n, src, level, nil, nil) }
+
+// MathInlineKind 行内的 $...$ 或 $$...$$
+var MathInlineKind = ast.NewNodeKind("MathInline")
+
+type MathInline struct {
+	ast.BaseInline
+	Segment text.Segment
+	Display bool
+}
+
+func (*MathInline) Kind() ast.NodeKind           { return MathInlineKind }
+func (n *MathInline) Dump(src []byte, level int) { ast.DumpHelper(n, src, level, nil, nil) }
+
+// MathScriptKind 文章包含公式时追加到末尾, 渲染为 KaTeX 的样式和脚本
+var MathScriptKind = ast.NewNodeKind("MathScript")
+
+type MathScript struct {
+	ast.BaseBlock
+}
+
+func (*MathScript) IsRaw() bool                  { return true }
+func (*MathScript) Kind() ast.NodeKind           { return MathScriptKind }
+func (n *MathScript) Dump(src []byte, level int) { ast.DumpHelper(n, src, level, nil, nil) }
+
+var mathDelim = []byte("$$")
+
+type mathBlockParser struct{}
+
+func (mathBlockParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], mathDelim) {
+		return nil, parser.NoChildren
+	}
+	node := &MathBlock{}
+	start := pos + len(mathDelim)
+	rest := util.TrimRightSpace(line[start:])
+	if end := bytes.Index(rest, mathDelim); end >= 0 {
+		// 同一行的 $$ 后面不能再有其他内容
+		if !util.IsBlank(rest[end+len(mathDelim):]) {
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(segment.Start+start, segment.Start+start+end))
+		node.closed = true
+	} else if !util.IsBlank(rest) {
+		node.Lines().Append(text.NewSegment(segment.Start+start, segment.Stop))
+	}
+	reader.AdvanceToEOL()
+	return node, parser.NoChildren
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	block := node.(*MathBlock)
+	if block.closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	trimmed := util.TrimRightSpace(line)
+	if bytes.HasSuffix(trimmed, mathDelim) {
+		if content := trimmed[:len(trimmed)-len(mathDelim)]; !util.IsBlank(content) {
+			node.Lines().Append(text.NewSegment(segment.Start, segment.Start+len(content)))
+		}
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.AdvanceToEOL()
+	return parser.Continue | parser.NoChildren
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+type mathInlineParser struct{}
+
+func (mathInlineParser) Trigger() []byte { return []byte{'$'} }
+
+// Parse 只识别同一行内的公式. $ 后面和结尾的 $ 前面不能是空格, 结尾的 $ 后面不能是数字,
+// 这样 "$5 和 $10" 这类文字不会被当作公式
+func (mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+	if len(line) <= delim || util.IsSpace(line[delim]) {
+		return nil
+	}
+	for i := delim; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+			continue
+		case line[i] != '$':
+			continue
+		}
+		if delim == 2 {
+			if i+1 >= len(line) || line[i+1] != '$' {
+				continue
+			}
+		} else if util.IsSpace(line[i-1]) || (i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9') {
+			continue
+		}
+		if i == delim {
+			return nil
+		}
+		block.Advance(i + delim)
+		return &MathInline{
+			Segment: text.NewSegment(segment.Start+delim, segment.Start+i),
+			Display: delim == 2,
+		}
+	}
+	return nil
+}
+
+// mathTransformer 文档中有公式时在末尾追加 MathScript, 没有公式的文章不会加载 KaTeX
+type mathTransformer struct{}
+
+func (mathTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	found := false
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && (n.Kind() == MathBlockKind || n.Kind() == MathInlineKind) {
+			found = true
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if found {
+		doc.AppendChild(doc, &MathScript{})
+	}
+}
+
+// mathRenderer 公式原样输出到带 math 类名的元素中, 由浏览器端的 KaTeX 渲染
+type mathRenderer struct {
+	katexURL string
+}
+
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(MathBlockKind, r.renderBlock)
+	reg.Register(MathInlineKind, r.renderInline)
+	reg.Register(MathScriptKind, r.renderScript)
+}
+
+func (r *mathRenderer) renderBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		w.WriteString("</div>\n")
+		return ast.WalkContinue, nil
+	}
+	w.WriteString(`<div class="math display">`)
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		template.HTMLEscape(w, segment.Value(source))
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *mathRenderer) renderInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*MathInline)
+	if n.Display {
+		w.WriteString(`<span class="math display">`)
+	} else {
+		w.WriteString(`<span class="math inline">`)
+	}
+	template.HTMLEscape(w, n.Segment.Value(source))
+	w.WriteString("</span>")
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderScript(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	url := template.HTMLEscapeString(r.katexURL)
+	w.WriteString(`<link rel="stylesheet" href="` + url + `/katex.min.css">` + "\n")
+	w.WriteString(`<script defer src="` + url + `/katex.min.js"></script>` + "\n")
+	w.WriteString(`<script>document.addEventListener("DOMContentLoaded", function () {
+  document.querySelectorAll(".math").forEach(function (el) {
+    katex.render(el.textContent, el, { displayMode: el.classList.contains("display"), throwOnError: false });
+  });
+});</script>` + "\n")
+	return ast.WalkContinue, nil
+}
+
+// mathExtender $...$ 行内公式和 $$ 公式块
+type mathExtender struct {
+	katexURL string
+}
+
+func (e *mathExtender) Extend(m goldmark.Markdown) {
+	url := e.katexURL
+	if url == "" {
+		url = defaultKatexURL
+	}
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 690)),
+		parser.WithInlineParsers(util.Prioritized(mathInlineParser{}, 150)),
+		parser.WithASTTransformers(util.Prioritized(mathTransformer{}, 100)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&mathRenderer{katexURL: url}, 100),
+	))
+}
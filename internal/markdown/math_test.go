@@ -0,0 +1,113 @@
+package markdown
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+)
+
+func renderMath(t *testing.T, source string) string {
+	t.Helper()
+	md := goldmark.New(goldmark.WithExtensions(&mathExtender{}))
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		t.Fatalf("convert %q: %v", source, err)
+	}
+	return buf.String()
+}
+
+func TestMath(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string // 输出中应包含的片段
+		absent []string // 输出中不应包含的片段
+	}{
+		{
+			name:   "inline",
+			source: "area $\\pi r^2$ here",
+			want:   []string{`<span class="math inline">\pi r^2</span>`, "katex.min.js"},
+		},
+		{
+			name:   "inline display",
+			source: "sum $$\\sum_i x_i$$ here",
+			want:   []string{`<span class="math display">\sum_i x_i</span>`},
+		},
+		{
+			name:   "prices",
+			source: "it costs $5 and $10",
+			want:   []string{"<p>it costs $5 and $10</p>"},
+			absent: []string{"math", "katex"},
+		},
+		{
+			name:   "space after opening",
+			source: "a $ b$ c",
+			absent: []string{"math"},
+		},
+		{
+			name:   "escaped dollar",
+			source: `price \$x$ here`,
+			want:   []string{"<p>price $x$ here</p>"},
+			absent: []string{"math"},
+		},
+		{
+			name:   "escaped dollar inside",
+			source: `$a \$ b$`,
+			want:   []string{`<span class="math inline">a \$ b</span>`},
+		},
+		{
+			name:   "code span",
+			source: "use `$x$` or `$$y$$` literally",
+			want:   []string{"<code>$x$</code>", "<code>$$y$$</code>"},
+			absent: []string{"math", "katex"},
+		},
+		{
+			name:   "fenced code",
+			source: "```\n$$\nx\n$$\n```",
+			absent: []string{"math", "katex"},
+		},
+		{
+			name:   "unclosed inline",
+			source: "only $$x here",
+			want:   []string{"<p>only $$x here</p>"},
+			absent: []string{"math"},
+		},
+		{
+			name:   "block",
+			source: "$$\na < b\n$$\n\nafter",
+			want:   []string{"<div class=\"math display\">a &lt; b\n</div>", "<p>after</p>"},
+		},
+		{
+			name:   "one line block",
+			source: "$$x = 1$$\n\nafter",
+			want:   []string{`<div class="math display">x = 1</div>`, "<p>after</p>"},
+		},
+		{
+			// 没有结束的 $$ 一直到文档末尾都是公式, 后面的内容不会按 markdown 渲染
+			name:   "unclosed block",
+			source: "before\n\n$$\nx\n\n# not a heading",
+			want:   []string{"<p>before</p>", "<div class=\"math display\">x\n\n# not a heading</div>"},
+			absent: []string{"<h1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := renderMath(t, tt.source)
+			for _, want := range tt.want {
+				if !strings.Contains(html, want) {
+					t.Errorf("output does not contain %q:\n%s", want, html)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(html, absent) {
+					t.Errorf("output contains %q:\n%s", absent, html)
+				}
+			}
+			if n := strings.Count(html, "katex.min.js"); n > 1 {
+				t.Errorf("katex script added %d times", n)
+			}
+		})
+	}
+}
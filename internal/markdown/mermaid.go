@@ -0,0 +1,161 @@
+package markdown
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"lazyblog/pkg/config"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+	"go.abhg.dev/goldmark/mermaid"
+)
+
+// 渲染失败回退到浏览器端渲染时, 在文档上做标记, 文末据此决定是否输出 mermaid 脚本
+const mermaidFallbackAttr = "mermaid-fallback"
+
+// mermaidExtender 解析和浏览器端渲染沿用 mermaid.Extender,
+// server 模式下用 mermaidServerRenderer 覆盖图表的渲染, 在发表时生成内联 SVG
+func mermaidExtender(cfg config.MarkdownConfig) goldmark.Extender {
+	return &mermaidServerExtender{
+		Extender: mermaid.Extender{RenderMode: mermaid.RenderModeClient, Theme: cfg.MermaidTheme},
+		server:   newMermaidServerRenderer(cfg),
+	}
+}
+
+type mermaidServerExtender struct {
+	mermaid.Extender
+	server *mermaidServerRenderer // 为 nil 时只使用浏览器端渲染
+}
+
+func (e *mermaidServerExtender) Extend(m goldmark.Markdown) {
+	e.Extender.Extend(m)
+	if e.server != nil {
+		// 数值越小优先级越高, 覆盖 mermaid.Extender 以 100 注册的 ClientRenderer
+		m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e.server, 50)))
+	}
+}
+
+// newMermaidServerRenderer 按 mermaid_mode 决定是否在服务端渲染, 找不到 mmdc 时返回 nil
+func newMermaidServerRenderer(cfg config.MarkdownConfig) *mermaidServerRenderer {
+	mode := strings.ToLower(cfg.MermaidMode)
+	switch mode {
+	case "client":
+		return nil
+	case "server", "auto":
+	default:
+		log.Printf("markdown: unknown mermaid_mode %q, use client", cfg.MermaidMode)
+		return nil
+	}
+	cli := cfg.MermaidCLI
+	if cli == "" {
+		cli = "mmdc"
+	}
+	path, err := exec.LookPath(cli)
+	if err != nil {
+		if mode == "server" {
+			log.Printf("markdown: mermaid cli %q not found, fall back to client rendering: %v", cli, err)
+		}
+		return nil
+	}
+	return &mermaidServerRenderer{
+		compiler: &mermaid.CLICompiler{CLI: mermaid.MMDC(path), Theme: cfg.MermaidTheme},
+		client:   &mermaid.ClientRenderer{Theme: cfg.MermaidTheme},
+		theme:    cfg.MermaidTheme,
+		cacheDir: cfg.MermaidCache,
+	}
+}
+
+// mermaidServerRenderer 用 mmdc 把图表渲染成 SVG, 结果按图表内容的哈希缓存到 cacheDir,
+// 单个图表渲染失败时输出浏览器端渲染所需的代码, 不影响文章发表
+type mermaidServerRenderer struct {
+	compiler mermaid.Compiler
+	client   *mermaid.ClientRenderer
+	theme    string
+	cacheDir string
+}
+
+func (r *mermaidServerRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(mermaid.Kind, r.renderBlock)
+	reg.Register(mermaid.ScriptKind, r.renderScript)
+}
+
+func (r *mermaidServerRenderer) renderBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		if _, fallback := node.AttributeString(mermaidFallbackAttr); fallback {
+			return r.client.Render(w, source, node, entering)
+		}
+		return ast.WalkContinue, nil
+	}
+
+	var buf bytes.Buffer
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		buf.Write(segment.Value(source))
+	}
+	svg, err := r.compile(buf.String())
+	if err != nil {
+		log.Printf("markdown: render mermaid diagram error, fall back to client rendering: %v", err)
+		node.SetAttributeString(mermaidFallbackAttr, true)
+		if doc := node.OwnerDocument(); doc != nil {
+			doc.SetAttributeString(mermaidFallbackAttr, true)
+		}
+		return r.client.Render(w, source, node, entering)
+	}
+	w.WriteString(`<div class="mermaid">`)
+	w.WriteString(svg)
+	w.WriteString("</div>")
+	return ast.WalkContinue, nil
+}
+
+// renderScript 只有存在回退的图表时才加载 mermaid 脚本
+func (r *mermaidServerRenderer) renderScript(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	doc := node.OwnerDocument()
+	if doc == nil {
+		return ast.WalkContinue, nil
+	}
+	if _, fallback := doc.AttributeString(mermaidFallbackAttr); !fallback {
+		return ast.WalkContinue, nil
+	}
+	return r.client.RenderScript(w, source, node, entering)
+}
+
+func (r *mermaidServerRenderer) compile(source string) (string, error) {
+	sum := sha256.Sum256([]byte(r.theme + "\n" + source))
+	file := ""
+	if r.cacheDir != "" {
+		file = filepath.Join(r.cacheDir, hex.EncodeToString(sum[:])+".svg")
+		if svg, err := os.ReadFile(file); err == nil {
+			return string(svg), nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	res, err := r.compiler.Compile(ctx, &mermaid.CompileRequest{Source: source})
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(res.SVG, "<svg") {
+		return "", fmt.Errorf("mermaid cli returned no svg")
+	}
+	if file != "" {
+		if err := os.MkdirAll(r.cacheDir, 0755); err == nil {
+			if err := os.WriteFile(file, []byte(res.SVG), 0644); err != nil {
+				log.Printf("markdown: write mermaid cache error: %v", err)
+			}
+		}
+	}
+	return res.SVG, nil
+}
@@ -0,0 +1,68 @@
+package markdown
+
+import (
+	"bytes"
+	"lazyblog/internal/model"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// ExtractToc 从 goldmark AST 中提取标题树, 依赖 parser.WithAutoHeadingID 生成的 id
+func ExtractToc(doc ast.Node, source []byte) []*model.TocItem {
+	root := make([]*model.TocItem, 0)
+	stack := make([]*model.TocItem, 0)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		heading, ok := n.(*ast.Heading)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		id, ok := heading.AttributeString("id")
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		idBytes, _ := id.([]byte)
+		item := &model.TocItem{
+			ID:    string(idBytes),
+			Title: nodeText(heading, source),
+			Level: heading.Level,
+		}
+		// 弹出所有级别不高于当前标题的节点, 栈顶即为父标题
+		for len(stack) > 0 && stack[len(stack)-1].Level >= item.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			root = append(root, item)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, item)
+		}
+		stack = append(stack, item)
+		return ast.WalkSkipChildren, nil
+	})
+	return root
+}
+
+func nodeText(n ast.Node, source []byte) string {
+	var buf bytes.Buffer
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := c.(type) {
+		case *ast.Text:
+			buf.Write(t.Segment.Value(source))
+			if t.SoftLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(t.Value)
+		case *MathInline:
+			buf.Write(t.Segment.Value(source))
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
@@ -1,7 +1,10 @@
 package model
 
 import (
-	"math/rand"
+	"encoding/json"
+	"fmt"
+	"lazyblog/pkg/config"
+	"net/url"
 	"strings"
 	"time"
 
@@ -11,32 +14,107 @@ import (
 type Post struct {
 	gorm.Model            // This will add ID, CreatedAt, UpdatedAt, DeletedAt fields
 	ID          int       `gorm:"primaryKey;autoIncrement"`
-	SID         int       `gorm:"column:sid;not null;unique" json:"sid"` // Unique identifier for the post
+	SID         int       `gorm:"column:sid;not null;unique" json:"sid"`                 // Unique identifier for the post
+	Slug        string    `gorm:"type:varchar(191);uniqueIndex" json:"slug" yaml:"slug"` // 地址中使用, 唯一且不为空
 	Title       string    `gorm:"type:varchar(255);not null" json:"title" yaml:"title"`
 	Content     string    `gorm:"type:text;not null" json:"content"`
 	Markdown    string    `gorm:"type:text;not null" json:"markdown" yaml:"markdown"` // Markdown content
 	Description string    `gorm:"type:varchar(500)" json:"description" yaml:"description"`
 	Author      string    `gorm:"type:varchar(100)" json:"author" yaml:"author"`
 	Published   bool      `gorm:"default:false" json:"published" yaml:"published"`
-	PubDate     time.Time `gorm:"type:datetime" json:"pub_date" yaml:"pubdate"`
+	PubDate     time.Time `json:"pub_date" yaml:"pubdate"`
 	Tags        string    `gorm:"type:varchar(255)" json:"tags" yaml:"tags"`         // Comma-separated tags
 	Category    string    `gorm:"type:varchar(100)" json:"category" yaml:"category"` // Category of the post
 	LikesCount  int64     `gorm:"default:0" json:"likes_count"`                      // Number of likes
 	File        string    `gorm:"type:varchar(255)" json:"file"`                     // File path if applicable
+	Toc         string    `gorm:"type:text" json:"-"`                                // JSON encoded []*TocItem
+	HideToc     bool      `gorm:"default:false" json:"hide_toc"`                     // front-matter `toc: false`
+}
+
+// BeforeSave 发布时间统一按 UTC 存储, sqlite 以文本比较时间时才能得到正确的先后顺序
+func (p *Post) BeforeSave(tx *gorm.DB) error {
+	p.PubDate = p.PubDate.UTC()
+	return nil
+}
+
+// AfterFind 按站点时区显示发布时间
+func (p *Post) AfterFind(tx *gorm.DB) error {
+	p.PubDate = p.PubDate.In(config.Cfg.Site.Location())
+	return nil
+}
+
+// AfterSave 保存后恢复为站点时区, 与查询出的文章一致
+func (p *Post) AfterSave(tx *gorm.DB) error {
+	return p.AfterFind(tx)
+}
+
+// IsLive 已发布且到了发布时间, 读者才能看到
+func (p Post) IsLive(now time.Time) bool {
+	return p.Published && !p.PubDate.After(now)
+}
+
+// Path 文章详情页的站内地址(不含 prefix), 格式由 site.permalink 决定, 没有 slug 的旧文章使用 /posts/<sid>
+func (p Post) Path() string {
+	if p.Slug == "" {
+		return fmt.Sprintf("/posts/%d", p.SID)
+	}
+	if config.Cfg.Site.Permalink == PermalinkDate {
+		date := p.PubDate
+		if date.IsZero() {
+			date = p.CreatedAt
+		}
+		date = date.In(config.Cfg.Site.Location())
+		return fmt.Sprintf("/%d/%02d/%s", date.Year(), date.Month(), url.PathEscape(p.Slug))
+	}
+	return "/posts/" + url.PathEscape(p.Slug)
+}
+
+// TocItem 文章目录中的一个标题, ID 与渲染后 HTML 中标题的 id 一致
+type TocItem struct {
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	Level    int        `json:"level"`
+	Children []*TocItem `json:"children,omitempty"`
+}
+
+// TocItems 解析存储的目录, 格式错误时返回 nil
+func (p Post) TocItems() []*TocItem {
+	if p.Toc == "" {
+		return nil
+	}
+	var items []*TocItem
+	if err := json.Unmarshal([]byte(p.Toc), &items); err != nil {
+		return nil
+	}
+	return items
 }
 
 type Comment struct {
 	gorm.Model           // This will add ID, CreatedAt, UpdatedAt, DeletedAt fields
 	ID         int       `gorm:"primaryKey;autoIncrement" json:"-"`
-	SID        int       `gorm:"column:sid;not null" json:"-"`
+	SID        int       `gorm:"column:sid;not null;uniqueIndex" json:"-"`
 	PostID     int       `gorm:"column:post_id;not null" json:"-"` // Foreign key to Post
 	PostSID    int       `gorm:"column:post_sid" json:"post_sid"`
+	ParentSID  int       `gorm:"column:parent_sid;default:0;index" json:"parent_sid"` // 回复的评论, 0 表示顶层评论
 	Content    string    `gorm:"type:text;not null" json:"content"`
 	Nickname   string    `gorm:"type:varchar(100);not null" json:"nickname"`
 	Email      string    `gorm:"type:varchar(100);not null" json:"email"`
 	Website    string    `gorm:"type:varchar(100)" json:"website"`
-	Approved   bool      `gorm:"default:false" json:"-"` // Whether the comment is approved
-	PubDate    time.Time `gorm:"type:datetime" json:"pub_date"`
+	Approved   bool      `gorm:"default:false" json:"-"`         // Whether the comment is approved
+	IsAuthor   bool      `gorm:"default:false" json:"is_author"` // 博主通过后台接口发表的回复
+	PubDate    time.Time `json:"pub_date"`
+}
+
+// Revision 文章的一个历史版本, 发表、修改和回滚时各记录一次, 内容与上一版本相同时不记录
+type Revision struct {
+	gorm.Model
+	PostID      int    `gorm:"column:post_id;not null;uniqueIndex:idx_revision_post_number"`
+	Number      int    `gorm:"not null;uniqueIndex:idx_revision_post_number"` // 每篇文章从 1 开始递增
+	Action      string `gorm:"type:varchar(50)"`                              // publish, edit, rollback to N, snapshot
+	Title       string `gorm:"type:varchar(255)"`
+	Author      string `gorm:"type:varchar(100)"`
+	FrontMatter string `gorm:"type:text"` // yaml
+	Markdown    string `gorm:"type:text"`
 }
 
 type FrendLink struct {
@@ -48,9 +126,24 @@ type FrendLink struct {
 	Enabled bool   `gorm:"default:true"`
 }
 
-func GenerateSID() int {
-	// This function should generate a unique SID for each post/comment/like.
-	return int(time.Now().Unix()-time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Unix())*100 + rand.Intn(100)
+// Like 每个访客对每篇文章最多一条记录, Fingerprint 来自签名 cookie 或哈希后的 IP
+type Like struct {
+	gorm.Model
+	PostID      int    `gorm:"column:post_id;not null;uniqueIndex:idx_like_post_fingerprint"`
+	Fingerprint string `gorm:"type:varchar(64);not null;uniqueIndex:idx_like_post_fingerprint"`
+}
+
+// Unsubscribe 不再接收邮件通知的邮箱
+type Unsubscribe struct {
+	gorm.Model
+	Email string `gorm:"type:varchar(100);not null;uniqueIndex"`
+}
+
+// Redirect 跳转到文章的旧地址, 来自 front-matter 的 aliases, 如从其他博客迁移前的文章地址
+type Redirect struct {
+	gorm.Model
+	Path   string `gorm:"type:varchar(191);not null;uniqueIndex"` // 解码后的路径, 不含末尾的 /
+	PostID int    `gorm:"column:post_id;not null;index"`
 }
 
 func ParseTags(tagStr string) []string {
@@ -62,6 +155,77 @@ func ParseTags(tagStr string) []string {
 	}
 	return tags
 }
+
+// site.permalink 支持的格式
+const (
+	PermalinkSlug = "/posts/:slug"
+	PermalinkDate = "/:year/:month/:slug"
+)
+
+// Live 筛选读者可见的文章: 已发布且发布时间不晚于当前时间, 定时发布的文章在此之前不出现在任何页面
+func Live() func(db *gorm.DB) *gorm.DB {
+	now := time.Now().UTC()
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("published = ? AND pub_date <= ?", true, now)
+	}
+}
+
+var pubDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParsePubDate 解析 front-matter 中的 pubdate, 可以带时间和时区, 如 2025-08-01 20:00 或 2025-08-01T20:00:00+08:00,
+// 不带时区时按站点时区解析, 为空时返回零值
+func ParsePubDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range pubDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, config.Cfg.Site.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid pubdate %q, expected 2006-01-02, 2006-01-02 15:04 or RFC 3339", s)
+}
+
+// FormatPubDate 与 ParsePubDate 对应, 零点只保留日期
+func FormatPubDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	t = t.In(config.Cfg.Site.Location())
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
+// WithTag 筛选 tags 字段中包含 tag 的文章, 仅使用 REPLACE/LIKE 以兼容 mysql/postgres/sqlite
+func WithTag(tag string) func(db *gorm.DB) *gorm.DB {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), " ", "")
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(tag)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("REPLACE(tags, ' ', '') = ? OR REPLACE(tags, ' ', '') LIKE ? ESCAPE '!' OR REPLACE(tags, ' ', '') LIKE ? ESCAPE '!' OR REPLACE(tags, ' ', '') LIKE ? ESCAPE '!'",
+			tag, escaped+",%", "%,"+escaped, "%,"+escaped+",%")
+	}
+}
+
+// WithCategory 筛选分类为 category 的文章
+func WithCategory(category string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("category = ?", category)
+	}
+}
+
 func SplitAndTrim(s, sep string) []string {
 	parts := make([]string, 0)
 	for _, part := range strings.Split(s, sep) {
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"lazyblog/pkg/sign"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To          string
+	Subject     string
+	Body        string
+	Unsubscribe string // 退订链接
+}
+
+// Sender 实际发送邮件, 默认为 SMTPSender
+type Sender interface {
+	Send(msg Message) error
+}
+
+var (
+	queue chan Message
+
+	retryBackoff = time.Second // 第一次重试前的等待时间, 之后每次乘以 5
+)
+
+// Start 启动后台发送协程, smtp.enable 为 false 时所有通知都会被忽略
+func Start() {
+	if !config.Cfg.Smtp.Enable {
+		return
+	}
+	StartWith(&SMTPSender{Config: config.Cfg.Smtp})
+}
+
+// StartWith 使用指定的 Sender 启动后台发送协程
+func StartWith(s Sender) {
+	queue = make(chan Message, 100)
+	go worker(queue, s)
+}
+
+func worker(queue <-chan Message, sender Sender) {
+	for msg := range queue {
+		retries := max(config.Cfg.Smtp.Retries, 0)
+		backoff := retryBackoff
+		for attempt := 0; ; attempt++ {
+			err := sender.Send(msg)
+			if err == nil {
+				break
+			}
+			if attempt >= retries {
+				log.Printf("notify: send to %s failed after %d attempts: %v", msg.To, attempt+1, err)
+				break
+			}
+			log.Printf("notify: send to %s failed, retry in %s: %v", msg.To, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 5
+		}
+	}
+}
+
+// enqueue 不阻塞调用方, 队列满时丢弃
+func enqueue(msg Message) {
+	if queue == nil || msg.To == "" || unsubscribed(msg.To) {
+		return
+	}
+	msg.Unsubscribe = UnsubscribeURL(msg.To)
+	select {
+	case queue <- msg:
+	default:
+		log.Printf("notify: queue full, drop message to %s", msg.To)
+	}
+}
+
+func unsubscribed(email string) bool {
+	var count int64
+	invoker.DB.Model(model.Unsubscribe{}).Where("email = ?", strings.ToLower(email)).Count(&count)
+	return count > 0
+}
+
+// UnsubscribeURL 带签名的退订链接
+func UnsubscribeURL(email string) string {
+	email = strings.ToLower(email)
+	return config.Cfg.Site.AbsURL("/unsubscribe?email=" + url.QueryEscape(email) + "&token=" + sign.Sign("unsubscribe:"+email))
+}
+
+func VerifyUnsubscribe(email, token string) bool {
+	return sign.Verify("unsubscribe:"+strings.ToLower(email), token)
+}
+
+func commentURL(post model.Post, comment model.Comment) string {
+	return config.Cfg.Site.AbsURL(fmt.Sprintf("%s#c-%d", post.Path(), comment.SID))
+}
+
+// NewComment 通知站长有新评论, 包括待审核的评论
+func NewComment(post model.Post, comment model.Comment) {
+	status := "已公开"
+	if !comment.Approved {
+		status = "待审核"
+	}
+	enqueue(Message{
+		To:      config.Cfg.Smtp.Owner,
+		Subject: fmt.Sprintf("[%s] 《%s》有新评论", config.Cfg.Site.Title, post.Title),
+		Body: fmt.Sprintf("%s <%s> 评论了《%s》(%s):\n\n%s\n\n查看: %s\n",
+			comment.Nickname, comment.Email, post.Title, status, comment.Content, commentURL(post, comment)),
+	})
+}
+
+// Reply 通知被回复的评论者, 只在回复公开后调用
+func Reply(post model.Post, reply model.Comment) {
+	if reply.ParentSID == 0 {
+		return
+	}
+	var parent model.Comment
+	if err := invoker.DB.Model(model.Comment{}).Where("sid = ?", reply.ParentSID).First(&parent).Error; err != nil {
+		return
+	}
+	if parent.Email == "" || strings.EqualFold(parent.Email, reply.Email) {
+		return
+	}
+	enqueue(Message{
+		To:      parent.Email,
+		Subject: fmt.Sprintf("[%s] 你在《%s》的评论有新回复", config.Cfg.Site.Title, post.Title),
+		Body: fmt.Sprintf("%s 回复了你的评论:\n\n> %s\n\n%s\n\n查看: %s\n",
+			reply.Nickname, parent.Content, reply.Content, commentURL(post, reply)),
+	})
+}
+
+// PostLive 通知站长定时发布的文章已经上线
+func PostLive(post model.Post) {
+	enqueue(Message{
+		To:      config.Cfg.Smtp.Owner,
+		Subject: fmt.Sprintf("[%s] 《%s》已定时发布", config.Cfg.Site.Title, post.Title),
+		Body: fmt.Sprintf("《%s》已于 %s 发布.\n\n查看: %s\n",
+			post.Title, post.PubDate.Format("2006-01-02 15:04"), config.Cfg.Site.AbsURL(post.Path())),
+	})
+}
+
+// SMTPSender 通过 SMTP 发送纯文本邮件
+type SMTPSender struct {
+	Config config.SmtpConfig
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.Config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	if msg.Unsubscribe != "" {
+		fmt.Fprintf(&buf, "List-Unsubscribe: <%s>\r\n", msg.Unsubscribe)
+	}
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	if msg.Unsubscribe != "" {
+		fmt.Fprintf(&buf, "\r\n--\r\n退订邮件通知: %s\r\n", msg.Unsubscribe)
+	}
+
+	addr := net.JoinHostPort(s.Config.Host, strconv.Itoa(s.Config.Port))
+	var auth smtp.Auth
+	if s.Config.Username != "" {
+		auth = smtp.PlainAuth("", s.Config.Username, s.Config.Password, s.Config.Host)
+	}
+	if !s.Config.SSL {
+		return smtp.SendMail(addr, auth, s.Config.From, []string{msg.To}, buf.Bytes())
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, &tls.Config{ServerName: s.Config.Host})
+	if err != nil {
+		return fmt.Errorf("dial smtp error: %w", err)
+	}
+	client, err := smtp.NewClient(conn, s.Config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp client error: %w", err)
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth error: %w", err)
+		}
+	}
+	if err := client.Mail(s.Config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,282 @@
+package notify
+
+import (
+	"bufio"
+	"errors"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/config"
+	"lazyblog/pkg/invoker"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mail smtpServer 收到的一封邮件
+type mail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// smtpServer 本地的 SMTP 替身, 只支持明文连接和发送邮件所需的命令
+type smtpServer struct {
+	ln    net.Listener
+	mails chan mail
+}
+
+func startSMTP(t *testing.T) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln, mails: make(chan mail, 10)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	var m mail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			tp.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			m = mail{From: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			tp.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			m.To = append(m.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.Data = string(data)
+			s.mails <- m
+			tp.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) config() config.SmtpConfig {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return config.SmtpConfig{
+		Enable:  true,
+		Host:    "127.0.0.1",
+		Port:    addr.Port,
+		SSL:     false,
+		From:    "blog@example.com",
+		Owner:   "owner@example.com",
+		Retries: 2,
+	}
+}
+
+func (s *smtpServer) receive(t *testing.T) mail {
+	t.Helper()
+	select {
+	case m := <-s.mails:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+	return mail{}
+}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "notify")
+	if err != nil {
+		panic(err)
+	}
+	config.Cfg.Auth.Secret = "test-secret"
+	config.Cfg.Site.Domain = "https://example.com"
+	config.Cfg.Database.Driver = "sqlite"
+	config.Cfg.Database.Path = filepath.Join(dir, "test.db")
+	invoker.Init()
+	if err := invoker.DB.AutoMigrate(model.Comment{}, model.Unsubscribe{}); err != nil {
+		panic(err)
+	}
+	retryBackoff = time.Millisecond
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func reset(t *testing.T) {
+	t.Helper()
+	invoker.DB.Exec("DELETE FROM comments")
+	invoker.DB.Exec("DELETE FROM unsubscribes")
+}
+
+// unsubscribeToken 从邮件头的 List-Unsubscribe 中取出退订链接的 email 和 token
+func unsubscribeToken(t *testing.T, data string) (string, string) {
+	t.Helper()
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(data))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("read mail header: %v", err)
+	}
+	link := strings.Trim(header.Get("List-Unsubscribe"), "<>")
+	if link == "" {
+		t.Fatal("List-Unsubscribe header is missing")
+	}
+	if !strings.Contains(data, link) {
+		t.Errorf("body does not contain the unsubscribe link %s", link)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("email"), u.Query().Get("token")
+}
+
+func TestNewCommentAndReply(t *testing.T) {
+	reset(t)
+	server := startSMTP(t)
+	config.Cfg.Smtp = server.config()
+	StartWith(&SMTPSender{Config: config.Cfg.Smtp})
+
+	post := model.Post{SID: 100, Title: "Hello"}
+	parent := model.Comment{SID: 1, PostSID: post.SID, Content: "first", Nickname: "alice", Email: "Alice@example.com", Approved: true}
+	if err := invoker.DB.Create(&parent).Error; err != nil {
+		t.Fatal(err)
+	}
+	reply := model.Comment{SID: 2, PostSID: post.SID, ParentSID: parent.SID, Content: "nice post", Nickname: "bob", Email: "bob@example.com", Approved: true}
+
+	NewComment(post, reply)
+	owner := server.receive(t)
+	if len(owner.To) != 1 || owner.To[0] != "owner@example.com" {
+		t.Fatalf("new comment sent to %v, want owner", owner.To)
+	}
+	if !strings.Contains(owner.Data, "nice post") || !strings.Contains(owner.Data, "#c-2") {
+		t.Errorf("new comment body misses the comment: %s", owner.Data)
+	}
+	email, token := unsubscribeToken(t, owner.Data)
+	if email != "owner@example.com" || !VerifyUnsubscribe(email, token) {
+		t.Errorf("invalid unsubscribe token for %s", email)
+	}
+
+	Reply(post, reply)
+	m := server.receive(t)
+	if len(m.To) != 1 || m.To[0] != "Alice@example.com" {
+		t.Fatalf("reply sent to %v, want the parent commenter", m.To)
+	}
+	if !strings.Contains(m.Data, "nice post") || !strings.Contains(m.Data, "first") {
+		t.Errorf("reply body misses the comments: %s", m.Data)
+	}
+	email, token = unsubscribeToken(t, m.Data)
+	if email != "alice@example.com" || !VerifyUnsubscribe("Alice@example.com", token) {
+		t.Errorf("invalid unsubscribe token for %s", email)
+	}
+	if VerifyUnsubscribe("bob@example.com", token) {
+		t.Error("token of one address must not unsubscribe another")
+	}
+}
+
+func TestUnsubscribedSkipped(t *testing.T) {
+	reset(t)
+	server := startSMTP(t)
+	config.Cfg.Smtp = server.config()
+	StartWith(&SMTPSender{Config: config.Cfg.Smtp})
+
+	post := model.Post{SID: 100, Title: "Hello"}
+	parent := model.Comment{SID: 1, PostSID: post.SID, Content: "first", Email: "alice@example.com", Approved: true}
+	invoker.DB.Create(&parent)
+	invoker.DB.Create(&model.Unsubscribe{Email: "owner@example.com"})
+	reply := model.Comment{SID: 2, PostSID: post.SID, ParentSID: parent.SID, Content: "nice post", Email: "bob@example.com", Approved: true}
+
+	// 通知站长的邮件被跳过, 收到的第一封应是给被回复者的
+	NewComment(post, reply)
+	Reply(post, reply)
+	m := server.receive(t)
+	if len(m.To) != 1 || m.To[0] != "alice@example.com" {
+		t.Fatalf("mail sent to %v, unsubscribed owner must be skipped", m.To)
+	}
+	select {
+	case m := <-server.mails:
+		t.Fatalf("unexpected mail to %v", m.To)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// failingSender 总是发送失败, 记录尝试的次数
+type failingSender struct {
+	attempts atomic.Int32
+}
+
+func (s *failingSender) Send(msg Message) error {
+	s.attempts.Add(1)
+	return errors.New("connection refused")
+}
+
+func TestRetry(t *testing.T) {
+	reset(t)
+	config.Cfg.Smtp.Owner = "owner@example.com"
+	config.Cfg.Smtp.Retries = 3
+	s := &failingSender{}
+	StartWith(s)
+
+	NewComment(model.Post{SID: 100, Title: "Hello"}, model.Comment{SID: 1, Content: "hi"})
+	// 重试间隔为 1ms, 5ms, 25ms
+	time.Sleep(500 * time.Millisecond)
+	if got, want := int(s.attempts.Load()), config.Cfg.Smtp.Retries+1; got != want {
+		t.Fatalf("sender called %d times, want %d", got, want)
+	}
+}
+
+// blockingSender 模拟没有响应的 SMTP 服务器
+type blockingSender struct {
+	release chan struct{}
+}
+
+func (s *blockingSender) Send(msg Message) error {
+	<-s.release
+	return nil
+}
+
+func TestNotBlockingComments(t *testing.T) {
+	reset(t)
+	config.Cfg.Smtp.Owner = "owner@example.com"
+	s := &blockingSender{release: make(chan struct{})}
+	defer close(s.release)
+	StartWith(s)
+
+	// CreateComment 中调用 NewComment, 发送卡住和队列已满时都应立即返回
+	post := model.Post{SID: 100, Title: "Hello"}
+	start := time.Now()
+	for i := range 200 {
+		NewComment(post, model.Comment{SID: i + 1, Content: "c" + strconv.Itoa(i)})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("NewComment blocked for %s", elapsed)
+	}
+}
@@ -0,0 +1,117 @@
+package rerender
+
+import (
+	"fmt"
+	"lazyblog/internal/cache"
+	"lazyblog/internal/diff"
+	"lazyblog/internal/markdown"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/invoker"
+
+	"gorm.io/gorm"
+)
+
+// Options 选择要重新渲染的文章, 条件为空时处理全部文章(包括草稿)
+type Options struct {
+	SIDs      []int  `json:"sids"`
+	Tag       string `json:"tag"`
+	Category  string `json:"category"`
+	DryRun    bool   `json:"dry_run"`    // 只比较不写入
+	BatchSize int    `json:"batch_size"` // 每批读取和写入的文章数, 默认 50
+
+	// Progress 每处理完一篇文章调用一次
+	Progress func(done, total int, post model.Post, changed bool) `json:"-"`
+}
+
+type PostResult struct {
+	SID   int    `json:"sid"`
+	Title string `json:"title"`
+	Diff  string `json:"diff,omitempty"` // 只在 dry run 时返回
+	Error string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Total   int          `json:"total"`
+	Changed int          `json:"changed"`
+	Failed  int          `json:"failed"`
+	DryRun  bool         `json:"dry_run"`
+	Posts   []PostResult `json:"posts"` // 有变化或渲染失败的文章
+}
+
+func (o Options) scope(db *gorm.DB) *gorm.DB {
+	if len(o.SIDs) > 0 {
+		db = db.Where("sid IN ?", o.SIDs)
+	}
+	if o.Tag != "" {
+		db = db.Scopes(model.WithTag(o.Tag))
+	}
+	if o.Category != "" {
+		db = db.Scopes(model.WithCategory(o.Category))
+	}
+	return db
+}
+
+// Run 用当前的 markdown 配置重新渲染 Post.Markdown, 每批文章在各自的短事务中写入,
+// 只更新 content 和 toc, 不修改 updated_at
+func Run(opts Options) (*Report, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+
+	var total int64
+	if err := invoker.DB.Model(model.Post{}).Scopes(opts.scope).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	report := &Report{Total: int(total), DryRun: opts.DryRun, Posts: make([]PostResult, 0)}
+
+	done := 0
+	posts := make([]model.Post, 0, batchSize)
+	err := invoker.DB.Model(model.Post{}).Scopes(opts.scope).FindInBatches(&posts, batchSize, func(_ *gorm.DB, _ int) error {
+		updated := make([]model.Post, 0, len(posts))
+		for _, post := range posts {
+			rendered := post
+			err := markdown.RenderPost(&rendered)
+			changed := err == nil && (rendered.Content != post.Content || rendered.Toc != post.Toc)
+			done++
+			switch {
+			case err != nil:
+				report.Failed++
+				report.Posts = append(report.Posts, PostResult{SID: post.SID, Title: post.Title, Error: err.Error()})
+			case changed:
+				report.Changed++
+				result := PostResult{SID: post.SID, Title: post.Title}
+				if opts.DryRun {
+					name := fmt.Sprintf("posts/%d", post.SID)
+					result.Diff = diff.Unified(name, name+" (rerendered)", post.Content, rendered.Content, 3) +
+						diff.Unified(name+"/toc", name+"/toc (rerendered)", post.Toc, rendered.Toc, 0)
+				}
+				report.Posts = append(report.Posts, result)
+				updated = append(updated, rendered)
+			}
+			if opts.Progress != nil {
+				opts.Progress(done, report.Total, post, changed)
+			}
+		}
+		if opts.DryRun || len(updated) == 0 {
+			return nil
+		}
+		return invoker.DB.Transaction(func(tx *gorm.DB) error {
+			for _, post := range updated {
+				err := tx.Model(model.Post{}).Where("id = ?", post.ID).
+					UpdateColumns(map[string]any{"content": post.Content, "toc": post.Toc}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}).Error
+	if err != nil {
+		return report, err
+	}
+	if !opts.DryRun && report.Changed > 0 {
+		cache.PurgeAll()
+	}
+	return report, nil
+}
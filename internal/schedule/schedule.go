@@ -0,0 +1,81 @@
+package schedule
+
+import (
+	"lazyblog/internal/cache"
+	"lazyblog/internal/model"
+	"lazyblog/internal/notify"
+	"lazyblog/internal/search"
+	"lazyblog/pkg/invoker"
+	"log"
+	"time"
+)
+
+// maxWait 两次检查的最长间隔, 直接修改数据库等没有调用 Reschedule 的变化最迟在这段时间内生效
+const maxWait = time.Minute
+
+var wake = make(chan struct{}, 1)
+
+// Start 启动定时发布的后台协程: 文章到达发布时间时加入搜索索引、清空页面缓存并通知站长.
+// 服务停止期间到达发布时间的文章在启动时由 search.Rebuild 建立索引, 不再发送通知
+func Start() {
+	go run(time.Now())
+}
+
+// Reschedule 在文章的发布状态或发布时间变化后调用, 让后台协程重新计算等待时间
+func Reschedule() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func run(since time.Time) {
+	for {
+		timer := time.NewTimer(wait(since))
+		select {
+		case <-timer.C:
+		case <-wake:
+			timer.Stop()
+		}
+		now := time.Now()
+		if publish(since, now) {
+			since = now
+		}
+	}
+}
+
+// wait 等到下一篇定时发布的文章, 最多等待 maxWait
+func wait(since time.Time) time.Duration {
+	posts := make([]model.Post, 0, 1)
+	err := invoker.DB.Model(model.Post{}).Select("pub_date").
+		Where("published = ? AND pub_date > ?", true, since.UTC()).
+		Order("pub_date").Limit(1).Find(&posts).Error
+	if err != nil || len(posts) == 0 {
+		return maxWait
+	}
+	return min(max(time.Until(posts[0].PubDate), 0), maxWait)
+}
+
+// publish 处理发布时间在 (since, now] 之间的文章, 查询失败时返回 false, 下次重新处理
+func publish(since, now time.Time) bool {
+	posts := make([]model.Post, 0)
+	err := invoker.DB.Model(model.Post{}).
+		Where("published = ? AND pub_date > ? AND pub_date <= ?", true, since.UTC(), now.UTC()).
+		Find(&posts).Error
+	if err != nil {
+		log.Printf("schedule: find scheduled posts error: %v", err)
+		return false
+	}
+	if len(posts) == 0 {
+		return true
+	}
+	for _, post := range posts {
+		search.Index(post)
+	}
+	cache.PurgeAll()
+	for _, post := range posts {
+		log.Printf("schedule: post %d %q is live", post.SID, post.Title)
+		notify.PostLive(post)
+	}
+	return true
+}
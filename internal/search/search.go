@@ -0,0 +1,344 @@
+package search
+
+import (
+	"html/template"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/invoker"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// 各字段的权重: 标题命中比正文命中更重要
+const (
+	titleWeight       = 5.0
+	descriptionWeight = 2.0
+	markdownWeight    = 1.0
+
+	snippetRunes = 160
+)
+
+type document struct {
+	post     model.Post
+	title    []rune
+	desc     []rune
+	text     []rune
+	termFreq map[string]float64 // 已按字段权重累加
+}
+
+type Result struct {
+	Post        model.Post
+	Score       float64
+	Title       template.HTML // 高亮后的标题
+	Description template.HTML // 高亮后的描述
+	Snippet     template.HTML // 正文中命中的片段
+}
+
+var (
+	mu       sync.RWMutex
+	docs     = make(map[int]*document) // post.ID -> document
+	postings = make(map[string]map[int]struct{})
+)
+
+// Rebuild 从数据库重建全部已发布文章的索引, 与存储后端无关
+func Rebuild() {
+	posts := make([]model.Post, 0)
+	if err := invoker.DB.Model(model.Post{}).Scopes(model.Live()).Find(&posts).Error; err != nil {
+		log.Printf("search: rebuild index error: %v", err)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	docs = make(map[int]*document, len(posts))
+	postings = make(map[string]map[int]struct{})
+	for _, post := range posts {
+		add(post)
+	}
+	log.Printf("search: indexed %d posts", len(posts))
+}
+
+// Index 新增或更新一篇文章, 未发布或未到发布时间的文章会从索引中移除
+func Index(post model.Post) {
+	mu.Lock()
+	defer mu.Unlock()
+	remove(post.ID)
+	if post.IsLive(time.Now()) {
+		add(post)
+	}
+}
+
+// Remove 从索引中删除文章
+func Remove(id int) {
+	mu.Lock()
+	defer mu.Unlock()
+	remove(id)
+}
+
+func add(post model.Post) {
+	doc := &document{
+		post:     post,
+		title:    []rune(post.Title),
+		desc:     []rune(post.Description),
+		text:     []rune(plainText(post.Markdown)),
+		termFreq: make(map[string]float64),
+	}
+	for _, term := range tokenize(post.Title) {
+		doc.termFreq[term] += titleWeight
+	}
+	for _, term := range tokenize(post.Description) {
+		doc.termFreq[term] += descriptionWeight
+	}
+	for _, term := range tokenize(string(doc.text)) {
+		doc.termFreq[term] += markdownWeight
+	}
+	docs[post.ID] = doc
+	for term := range doc.termFreq {
+		if postings[term] == nil {
+			postings[term] = make(map[int]struct{})
+		}
+		postings[term][post.ID] = struct{}{}
+	}
+}
+
+func remove(id int) {
+	doc, ok := docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.termFreq {
+		delete(postings[term], id)
+		if len(postings[term]) == 0 {
+			delete(postings, term)
+		}
+	}
+	delete(docs, id)
+}
+
+// Search 返回按相关度排序的第 page 页结果以及命中总数
+func Search(query string, page, size int) ([]Result, int) {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return []Result{}, 0
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	type scored struct {
+		doc     *document
+		score   float64
+		matched int
+	}
+	hits := make(map[int]*scored)
+	total := float64(len(docs))
+	for _, term := range terms {
+		ids := postings[term]
+		if len(ids) == 0 {
+			continue
+		}
+		idf := math.Log(1 + total/float64(len(ids)))
+		for id := range ids {
+			doc := docs[id]
+			h, ok := hits[id]
+			if !ok {
+				h = &scored{doc: doc}
+				hits[id] = h
+			}
+			// 词频做对数平滑, 避免长文堆砌关键词
+			h.score += (1 + math.Log(doc.termFreq[term])) * idf
+			h.matched++
+		}
+	}
+
+	ranked := make([]*scored, 0, len(hits))
+	for _, h := range hits {
+		// 命中的查询词越多越靠前
+		h.score *= float64(h.matched) / float64(len(terms))
+		ranked = append(ranked, h)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].doc.post.PubDate.After(ranked[j].doc.post.PubDate)
+	})
+
+	start := (page - 1) * size
+	if start >= len(ranked) {
+		return []Result{}, len(ranked)
+	}
+	end := min(start+size, len(ranked))
+
+	keywords := highlightTerms(query, terms)
+	results := make([]Result, 0, end-start)
+	for _, h := range ranked[start:end] {
+		results = append(results, Result{
+			Post:        h.doc.post,
+			Score:       h.score,
+			Title:       highlight(h.doc.title, keywords),
+			Description: highlight(h.doc.desc, keywords),
+			Snippet:     snippet(h.doc.text, keywords),
+		})
+	}
+	return results, len(ranked)
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// tokenize 英文/数字按单词切分, 中日韩文字切为单字和二元组
+func tokenize(s string) []string {
+	tokens := make([]string, 0)
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		for i := range cjk {
+			tokens = append(tokens, string(cjk[i]))
+			if i+1 < len(cjk) {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range s {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// queryTerms 查询中连续的中日韩文字只取二元组, 单字查询才使用单字
+func queryTerms(query string) []string {
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+	for _, token := range tokenize(query) {
+		runes := []rune(token)
+		if len(runes) == 1 && isCJK(runes[0]) && hasCJKNeighbour(query, runes[0]) {
+			continue
+		}
+		if !seen[token] {
+			seen[token] = true
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
+
+func hasCJKNeighbour(query string, r rune) bool {
+	runes := []rune(query)
+	for i, c := range runes {
+		if c != r {
+			continue
+		}
+		if (i > 0 && isCJK(runes[i-1])) || (i+1 < len(runes) && isCJK(runes[i+1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlightTerms 高亮时同时使用原始查询词和切分后的词
+func highlightTerms(query string, terms []string) [][]rune {
+	keywords := make([][]rune, 0)
+	for _, field := range strings.Fields(strings.ToLower(query)) {
+		keywords = append(keywords, []rune(field))
+	}
+	for _, term := range terms {
+		keywords = append(keywords, []rune(term))
+	}
+	return keywords
+}
+
+// markKeywords 标记 text 中所有命中关键词的位置(忽略大小写)
+func markKeywords(text []rune, keywords [][]rune) []bool {
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	marked := make([]bool, len(text))
+	for _, kw := range keywords {
+		if len(kw) == 0 {
+			continue
+		}
+		for i := 0; i+len(kw) <= len(lower); i++ {
+			if string(lower[i:i+len(kw)]) == string(kw) {
+				for j := i; j < i+len(kw); j++ {
+					marked[j] = true
+				}
+			}
+		}
+	}
+	return marked
+}
+
+func render(text []rune, marked []bool) template.HTML {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		j := i
+		for j < len(text) && marked[j] == marked[i] {
+			j++
+		}
+		chunk := template.HTMLEscapeString(string(text[i:j]))
+		if marked[i] {
+			b.WriteString("<mark>" + chunk + "</mark>")
+		} else {
+			b.WriteString(chunk)
+		}
+		i = j
+	}
+	return template.HTML(b.String())
+}
+
+func highlight(text []rune, keywords [][]rune) template.HTML {
+	return render(text, markKeywords(text, keywords))
+}
+
+// snippet 截取正文中第一个命中位置附近的片段
+func snippet(text []rune, keywords [][]rune) template.HTML {
+	marked := markKeywords(text, keywords)
+	first := 0
+	for i, m := range marked {
+		if m {
+			first = i
+			break
+		}
+	}
+	start := max(0, first-snippetRunes/4)
+	end := min(len(text), start+snippetRunes)
+	html := render(text[start:end], marked[start:end])
+	if start > 0 {
+		html = "..." + html
+	}
+	if end < len(text) {
+		html += "..."
+	}
+	return html
+}
+
+// plainText 去掉常见的 markdown 标记, 合并空白
+func plainText(md string) string {
+	replacer := strings.NewReplacer("```", " ", "`", "", "**", "", "#", "", ">", "", "|", " ")
+	return strings.Join(strings.Fields(replacer.Replace(md)), " ")
+}
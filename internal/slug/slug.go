@@ -0,0 +1,212 @@
+package slug
+
+import (
+	"errors"
+	"fmt"
+	"lazyblog/internal/model"
+	"lazyblog/pkg/invoker"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mozillazg/go-pinyin"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// maxRunes slug 的最大长度
+const maxRunes = 80
+
+// NFKD 不会拆分的拉丁字母
+var latin = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'ł': "l", 'þ': "th", 'ı': "i",
+}
+
+// 汉字转换为不带声调的拼音, 多音字取最常用的读音
+var pinyinArgs = pinyin.NewArgs()
+
+// Make 把标题转换为只含小写字母、数字和 - 的 slug: 汉字转换为拼音, 去掉重音符号,
+// 假名、谚文等无法转写的文字被忽略, 全部被忽略时返回空字符串
+func Make(s string) string {
+	return build(s, true)
+}
+
+// Urlize 与 Make 相同但保留各种文字, 用于计算 hexo、hugo 等由标题生成的原地址
+func Urlize(s string) string {
+	return build(s, false)
+}
+
+func build(s string, ascii bool) string {
+	s = norm.NFKD.String(strings.ToLower(s))
+	var b strings.Builder
+	dash := false // 下一个单词前需要 -
+	count := 0
+	full := false // 拼音等多个字母的单词放不下时整个舍去, 不超过 maxRunes
+	write := func(word string) {
+		n := utf8.RuneCountInString(word)
+		sep := dash && b.Len() > 0
+		if sep {
+			n++
+		}
+		if count+n > maxRunes {
+			full = true
+			return
+		}
+		if sep {
+			b.WriteByte('-')
+		}
+		dash = false
+		b.WriteString(word)
+		count += n
+	}
+	for _, r := range s {
+		if full {
+			break
+		}
+		switch t, ok := latin[r]; {
+		case unicode.Is(unicode.Mn, r):
+		case ok:
+			write(t)
+		case ascii && unicode.Is(unicode.Han, r):
+			// 每个字的拼音作为一个单词
+			dash = true
+			if py := pinyin.SinglePinyin(r, pinyinArgs); len(py) > 0 && py[0] != "" {
+				write(py[0])
+			}
+			dash = true
+		case (unicode.IsLetter(r) || unicode.IsDigit(r)) && (!ascii || r <= unicode.MaxASCII):
+			write(string(r))
+		default:
+			dash = true
+		}
+	}
+	// 重新组合被 NFKD 拆开的韩文等字符
+	return norm.NFC.String(strings.Trim(b.String(), "-"))
+}
+
+// Fallback 标题无法生成 slug 时使用 post-<sid>, 新文章在插入时才分配 SID
+func Fallback(sid int) string {
+	return fmt.Sprintf("post-%d", sid)
+}
+
+// numeric 全是数字的地址会被当作 SID
+func numeric(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }) < 0
+}
+
+// taken slug 是否已被其他文章使用, 包括已删除的文章, 以免恢复后冲突
+func taken(db *gorm.DB, slug string, id int) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(model.Post{}).Where("slug = ? AND id <> ?", slug, id).Count(&count).Error
+	return count > 0, err
+}
+
+// usedError 手动设置的 slug 与其他文章重复
+func usedError(s string) error {
+	return fmt.Errorf("slug %q is already used by another post", s)
+}
+
+// SaveError 把保存文章时 slug 唯一索引的冲突转换为与 Assign 相同的错误.
+// 检查和写入之间其他请求可能占用了同一个 slug, 以唯一索引为准
+func SaveError(err error, post model.Post) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return usedError(post.Slug)
+	}
+	return err
+}
+
+// Assign 设置文章的 slug. explicit 来自 front-matter, 与其他文章重复时返回错误;
+// explicit 为空时保留文章已有的 slug, 否则由标题生成, 重复时加上 -2、-3 等后缀,
+// 标题无法生成 slug 时使用 Fallback, 还没有 SID 的新文章留空, 由插入时分配.
+// db 可以是事务, 以便检查同一事务中新增的文章
+func Assign(db *gorm.DB, post *model.Post, explicit string) error {
+	if explicit != "" {
+		s := Make(explicit)
+		if s == "" || numeric(s) {
+			return fmt.Errorf("invalid slug %q, it must contain letters", explicit)
+		}
+		used, err := taken(db, s, post.ID)
+		if err != nil {
+			return err
+		}
+		if used {
+			return usedError(s)
+		}
+		post.Slug = s
+		return nil
+	}
+	if post.Slug != "" {
+		return nil
+	}
+
+	base := Make(post.Title)
+	if base == "" {
+		if post.SID != 0 {
+			post.Slug = Fallback(post.SID)
+		}
+		return nil
+	}
+	if numeric(base) {
+		base = "post-" + base
+	}
+	s := base
+	for i := 2; ; i++ {
+		used, err := taken(db, s, post.ID)
+		if err != nil {
+			return err
+		}
+		if !used {
+			break
+		}
+		s = fmt.Sprintf("%s-%d", base, i)
+	}
+	post.Slug = s
+	return nil
+}
+
+// Backfill 为没有 slug 的旧文章按标题生成 slug, 并为 slug 重复的文章(保留最早的一篇)重新生成,
+// 以便建立唯一索引, 返回处理的文章数
+func Backfill() (int, error) {
+	posts := make([]model.Post, 0)
+	if err := invoker.DB.Unscoped().Model(model.Post{}).Where("slug = ? OR slug IS NULL", "").Order("id").Find(&posts).Error; err != nil {
+		return 0, err
+	}
+	duplicates := make([]string, 0)
+	if err := invoker.DB.Unscoped().Model(model.Post{}).Where("slug <> ?", "").Group("slug").Having("COUNT(*) > 1").Pluck("slug", &duplicates).Error; err != nil {
+		return 0, err
+	}
+	for _, s := range duplicates {
+		same := make([]model.Post, 0)
+		if err := invoker.DB.Unscoped().Model(model.Post{}).Where("slug = ?", s).Order("id").Find(&same).Error; err != nil {
+			return 0, err
+		}
+		for _, post := range same[1:] {
+			post.Slug = ""
+			posts = append(posts, post)
+		}
+	}
+	for i := range posts {
+		if err := Assign(invoker.DB, &posts[i], ""); err != nil {
+			return i, err
+		}
+		if err := invoker.DB.Unscoped().Model(model.Post{}).Where("id = ?", posts[i].ID).UpdateColumn("slug", posts[i].Slug).Error; err != nil {
+			return i, err
+		}
+	}
+	return len(posts), nil
+}
+
+// Prepare 在 AutoMigrate 建立唯一索引之前调用: 添加 slug 列并为已有文章生成不重复的 slug,
+// 返回处理的文章数
+func Prepare() (int, error) {
+	m := invoker.DB.Migrator()
+	if !m.HasTable(&model.Post{}) {
+		return 0, nil
+	}
+	if !m.HasColumn(&model.Post{}, "Slug") {
+		if err := m.AddColumn(&model.Post{}, "Slug"); err != nil {
+			return 0, err
+		}
+	}
+	return Backfill()
+}
@@ -0,0 +1,149 @@
+package slug
+
+import (
+	"lazyblog/internal/model"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  --Go--1.24--  ", "go-1-24"},
+		{"你好世界", "ni-hao-shi-jie"},
+		{"Go 语言入门", "go-yu-yan-ru-men"},
+		{"重庆", "zhong-qing"}, // 多音字取最常用的读音
+		{"Crème Brûlée", "creme-brulee"},
+		{"Straße Ærø Łódź", "strasse-aero-lodz"},
+		{"ｆｕｌｌ　ｗｉｄｔｈ１２", "full-width12"},
+		{"こんにちは", ""},
+		{"안녕하세요", ""},
+		{"C++ & Rust", "c-rust"},
+		{"2024", "2024"}, // 全是数字时由 Assign 处理
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Make(tt.in); got != tt.want {
+			t.Errorf("Make(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUrlize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"你好 世界", "你好-世界"},
+		{"Go 语言入门", "go-语言入门"},
+		{"Crème Brûlée", "creme-brulee"},
+		{"Straße", "strasse"},
+		{"안녕 하세요", "안녕-하세요"}, // NFKD 拆开的谚文重新组合
+		{"こんにちは、世界", "こんにちは-世界"},
+	}
+	for _, tt := range tests {
+		if got := Urlize(tt.in); got != tt.want {
+			t.Errorf("Urlize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMaxRunes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{strings.Repeat("a", 100), strings.Repeat("a", maxRunes)},
+		{strings.Repeat("ab ", 40), strings.Repeat("ab-", 26) + "ab"},
+		// 每个字的拼音 5 个字母加上 -, 第 14 个放不下时整个舍去
+		{strings.Repeat("中", 30), strings.Repeat("zhong-", 12) + "zhong"},
+		{strings.Repeat("a", 79) + " ß", strings.Repeat("a", 79)},
+	}
+	for _, tt := range tests {
+		got := Make(tt.in)
+		if got != tt.want {
+			t.Errorf("Make(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(got); n > maxRunes || strings.HasSuffix(got, "-") {
+			t.Errorf("Make(%q) = %q, %d runes", tt.in, got, n)
+		}
+	}
+	if got := Urlize(strings.Repeat("世", 100)); utf8.RuneCountInString(got) != maxRunes {
+		t.Errorf("Urlize cut to %d runes, want %d", utf8.RuneCountInString(got), maxRunes)
+	}
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(model.Post{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestAssign(t *testing.T) {
+	db := openDB(t)
+	for i, s := range []string{"hello-world", "post-2024", "taken"} {
+		if err := db.Create(&model.Post{SID: i + 1, Slug: s, Title: s}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		post     model.Post
+		explicit string
+		want     string
+		wantErr  bool
+	}{
+		{name: "from title", post: model.Post{Title: "Go 入门"}, want: "go-ru-men"},
+		{name: "suffix", post: model.Post{Title: "Hello World"}, want: "hello-world-2"},
+		{name: "numeric title", post: model.Post{Title: "2024"}, want: "post-2024-2"},
+		{name: "numeric title with sid", post: model.Post{Title: "42", SID: 7}, want: "post-42"},
+		{name: "keep existing", post: model.Post{Title: "Other", Slug: "kept"}, want: "kept"},
+		{name: "fallback", post: model.Post{Title: "こんにちは", SID: 9}, want: "post-9"},
+		{name: "fallback without sid", post: model.Post{Title: "こんにちは"}, want: ""},
+		{name: "explicit", post: model.Post{Title: "x"}, explicit: "My Slug", want: "my-slug"},
+		{name: "explicit pinyin", post: model.Post{Title: "x"}, explicit: "你好", want: "ni-hao"},
+		{name: "explicit numeric", post: model.Post{Title: "x"}, explicit: "2024", wantErr: true},
+		{name: "explicit empty after folding", post: model.Post{Title: "x"}, explicit: "!!!", wantErr: true},
+		{name: "explicit taken", post: model.Post{Title: "x"}, explicit: "Taken", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := tt.post
+			err := Assign(db, &post, tt.explicit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Assign error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && post.Slug != tt.want {
+				t.Errorf("slug = %q, want %q", post.Slug, tt.want)
+			}
+		})
+	}
+
+	// 保存自己时 slug 不算被占用
+	var own model.Post
+	db.Where("slug = ?", "taken").First(&own)
+	if err := Assign(db, &own, "taken"); err != nil || own.Slug != "taken" {
+		t.Errorf("reassign own slug = %q, %v", own.Slug, err)
+	}
+}
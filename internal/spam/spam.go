@@ -0,0 +1,219 @@
+package spam
+
+import (
+	"fmt"
+	"lazyblog/pkg/config"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Submission 待检查的评论
+type Submission struct {
+	IP       string
+	Content  string
+	Nickname string
+	Email    string
+	Website  string
+	Honeypot string // 评论表单中对用户隐藏的 address 字段, 正常用户不会填写
+}
+
+// Rejection 被拦截的原因, Status 为返回给客户端的 http 状态码
+type Rejection struct {
+	Status int
+	Check  string
+	Reason string
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("%s: %s", r.Check, r.Reason)
+}
+
+func reject(status int, check, reason string) *Rejection {
+	return &Rejection{Status: status, Check: check, Reason: reason}
+}
+
+// Checker 单个检查项, 通过时返回 nil
+type Checker interface {
+	Check(s *Submission) *Rejection
+}
+
+// CheckerFunc 让普通函数实现 Checker
+type CheckerFunc func(s *Submission) *Rejection
+
+func (f CheckerFunc) Check(s *Submission) *Rejection {
+	return f(s)
+}
+
+// Pipeline 依次执行检查, 遇到第一个拦截即返回
+type Pipeline []Checker
+
+func (p Pipeline) Check(s *Submission) *Rejection {
+	for _, checker := range p {
+		if r := checker.Check(s); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// NewPipeline 根据 [comment] 配置组装默认的检查流程
+func NewPipeline(cfg config.CommentConfig) Pipeline {
+	pipeline := Pipeline{CheckerFunc(checkHoneypot)}
+	if cfg.RateLimit > 0 {
+		pipeline = append(pipeline, NewRateLimiter(cfg.RateLimit, cfg.RateBurst))
+	}
+	pipeline = append(pipeline,
+		CheckerFunc(checkRequired),
+		LengthChecker{MaxContent: cfg.MaxLength},
+		CheckerFunc(checkEmail),
+		CheckerFunc(checkWebsite),
+		LinkChecker{MaxLinks: cfg.MaxLinks},
+	)
+	if len(cfg.BlockedWords) > 0 {
+		pipeline = append(pipeline, BlockedWords(cfg.BlockedWords))
+	}
+	return pipeline
+}
+
+func checkHoneypot(s *Submission) *Rejection {
+	if s.Honeypot != "" {
+		return reject(http.StatusBadRequest, "honeypot", "invalid request")
+	}
+	return nil
+}
+
+func checkRequired(s *Submission) *Rejection {
+	if strings.TrimSpace(s.Content) == "" || strings.TrimSpace(s.Nickname) == "" || strings.TrimSpace(s.Email) == "" {
+		return reject(http.StatusBadRequest, "required", "nickname, email and comment are required")
+	}
+	return nil
+}
+
+// LengthChecker 限制评论长度, 昵称/邮箱/网址受数据库字段长度限制
+type LengthChecker struct {
+	MaxContent int
+}
+
+func (l LengthChecker) Check(s *Submission) *Rejection {
+	if l.MaxContent > 0 && utf8.RuneCountInString(s.Content) > l.MaxContent {
+		return reject(http.StatusBadRequest, "length", fmt.Sprintf("comment must be at most %d characters", l.MaxContent))
+	}
+	if len(s.Nickname) > 100 || len(s.Email) > 100 || len(s.Website) > 100 {
+		return reject(http.StatusBadRequest, "length", "nickname, email and website must be at most 100 bytes")
+	}
+	return nil
+}
+
+func checkEmail(s *Submission) *Rejection {
+	addr, err := mail.ParseAddress(s.Email)
+	if err != nil || addr.Address != s.Email || !strings.Contains(s.Email[strings.LastIndex(s.Email, "@"):], ".") {
+		return reject(http.StatusBadRequest, "email", "invalid email address")
+	}
+	return nil
+}
+
+// checkWebsite 网址会被渲染成链接, 只允许 http(s)
+func checkWebsite(s *Submission) *Rejection {
+	if s.Website == "" {
+		return nil
+	}
+	website := strings.ToLower(s.Website)
+	if !strings.HasPrefix(website, "http://") && !strings.HasPrefix(website, "https://") {
+		return reject(http.StatusBadRequest, "website", "website must start with http:// or https://")
+	}
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)`)
+
+// LinkChecker 评论中的链接数量超过 MaxLinks 时拦截
+type LinkChecker struct {
+	MaxLinks int
+}
+
+func (l LinkChecker) Check(s *Submission) *Rejection {
+	if l.MaxLinks < 0 {
+		return nil
+	}
+	if n := len(linkPattern.FindAllStringIndex(s.Content, -1)); n > l.MaxLinks {
+		return reject(http.StatusUnprocessableEntity, "links", fmt.Sprintf("comment contains too many links (%d > %d)", n, l.MaxLinks))
+	}
+	return nil
+}
+
+// BlockedWords 评论、昵称、网址中包含任意屏蔽词时拦截, 忽略大小写
+type BlockedWords []string
+
+func (b BlockedWords) Check(s *Submission) *Rejection {
+	text := strings.ToLower(s.Content + "\n" + s.Nickname + "\n" + s.Website)
+	for _, word := range b {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" && strings.Contains(text, word) {
+			return reject(http.StatusUnprocessableEntity, "blocked_words", "comment contains blocked words")
+		}
+	}
+	return nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter 按 IP 的令牌桶, 每分钟补充 perMinute 个令牌, 最多积累 burst 个
+type RateLimiter struct {
+	mu        sync.Mutex
+	perMinute float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(perMinute float64, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &RateLimiter{
+		perMinute: perMinute,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+	}
+}
+
+func (r *RateLimiter) Check(s *Submission) *Rejection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.sweep(now)
+	b, ok := r.buckets[s.IP]
+	if !ok {
+		b = &bucket{tokens: r.burst, last: now}
+		r.buckets[s.IP] = b
+	}
+	b.tokens = min(r.burst, b.tokens+now.Sub(b.last).Minutes()*r.perMinute)
+	b.last = now
+	if b.tokens < 1 {
+		return reject(http.StatusTooManyRequests, "rate_limit", "too many comments, please try again later")
+	}
+	b.tokens--
+	return nil
+}
+
+// sweep 定期清理已经补满的桶, 避免 map 无限增长
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < 10*time.Minute {
+		return
+	}
+	r.lastSweep = now
+	for ip, b := range r.buckets {
+		if b.tokens+now.Sub(b.last).Minutes()*r.perMinute >= r.burst {
+			delete(r.buckets, ip)
+		}
+	}
+}
@@ -1,31 +1,34 @@
 package view
 
 import (
-	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
 	"html/template"
+	"lazyblog/internal/cache"
+	"lazyblog/internal/markdown"
 	"lazyblog/internal/model"
 	"lazyblog/pkg/invoker"
 	"os"
 	"sort"
 	"time"
 
-	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/spf13/viper"
-	"github.com/yuin/goldmark"
-	highlighting "github.com/yuin/goldmark-highlighting/v2"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
-	"go.abhg.dev/goldmark/mermaid"
+)
+
+var (
+	// queries 标签、分类、友链等每个页面都会用到的聚合查询
+	queries = cache.New("queries")
+	// fragments markdown 渲染结果, 以内容的哈希为 key
+	fragments = cache.New("fragments")
 )
 
 func GetLinks() []model.FrendLink {
-	var links []model.FrendLink
-	invoker.DB.Model(&model.FrendLink{}).Where("enabled = ?", true).Find(&links)
-	return links
+	return cache.Remember(queries, "links", func() []model.FrendLink {
+		var links []model.FrendLink
+		invoker.DB.Model(&model.FrendLink{}).Where("enabled = ?", true).Find(&links)
+		return links
+	})
 }
 
 type CategoryWithCount struct {
@@ -34,10 +37,14 @@ type CategoryWithCount struct {
 }
 
 func GetCategories() []CategoryWithCount {
+	return cache.Remember(queries, "categories", loadCategories)
+}
+
+func loadCategories() []CategoryWithCount {
 	var categories []CategoryWithCount
 	var posts []model.Post
 
-	invoker.DB.Model(model.Post{}).Find(&posts)
+	invoker.DB.Model(model.Post{}).Scopes(model.Live()).Find(&posts)
 	categoryCountMap := make(map[string]int64)
 	for _, post := range posts {
 		categoryCountMap[post.Category]++
@@ -60,10 +67,14 @@ type TagWithCount struct {
 }
 
 func GetTags() []TagWithCount {
+	return cache.Remember(queries, "tags", loadTags)
+}
+
+func loadTags() []TagWithCount {
 	var tags []TagWithCount
 	var posts []model.Post
 
-	invoker.DB.Model(model.Post{}).Find(&posts)
+	invoker.DB.Model(model.Post{}).Scopes(model.Live()).Find(&posts)
 	tagCountMap := make(map[string]int64)
 	for _, post := range posts {
 		postTags := model.ParseTags(post.Tags)
@@ -133,32 +144,25 @@ func Truncate(s string, n int) string {
 }
 
 func Md2Html(md string) template.HTML {
-	mdParser := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("monokai"),
-				highlighting.WithFormatOptions(
-					chromahtml.WithLineNumbers(true),
-				),
-			),
-			&mermaid.Extender{RenderMode: mermaid.RenderModeClient, Theme: "dark"},
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			html.WithHardWraps(),
-			html.WithXHTML(),
-		),
-	)
-
-	var buf []byte
-	writer := bytes.NewBuffer(buf)
-	if err := mdParser.Convert([]byte(md), writer); err != nil {
-		return ""
+	sum := md5.Sum([]byte(md))
+	return cache.Remember(fragments, hex.EncodeToString(sum[:]), func() template.HTML {
+		content, err := markdown.Convert(md)
+		if err != nil {
+			return ""
+		}
+		return template.HTML(content)
+	})
+}
+
+// PostToc 返回文章目录, 旧数据没有存储目录时从 Markdown 重新提取
+func PostToc(post model.Post) []*model.TocItem {
+	if post.HideToc {
+		return nil
+	}
+	if items := post.TocItems(); items != nil {
+		return items
 	}
-	return template.HTML(writer.String())
+	return markdown.Toc(post.Markdown)
 }
 
 func AboutMe() template.HTML {
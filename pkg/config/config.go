@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -10,6 +12,12 @@ var (
 	Cfg *Config
 )
 
+type DatabaseConfig struct {
+	Driver   string `mapstructure:"driver"`   // mysql, postgres or sqlite
+	Path     string `mapstructure:"path"`     // sqlite database file
+	Timezone string `mapstructure:"timezone"` // session timezone for mysql/postgres
+}
+
 type MysqlConfig struct {
 	Host     string
 	Port     int32
@@ -18,15 +26,65 @@ type MysqlConfig struct {
 	Database string
 }
 
+type PostgresConfig struct {
+	Host     string
+	Port     int32
+	User     string
+	Password string
+	Database string
+	SSLMode  string `mapstructure:"sslmode"`
+}
+
 type SiteConfig struct {
 	Prefix string `mapstructure:"prefix"`
 	Title  string `mapstructure:"title"`
 	About  string `mapstructure:"about"`
 	Domain string `mapstructure:"domain"`
+	Author string `mapstructure:"author"`
+
+	// Timezone 解析 front-matter 中不带时区的 pubdate, 以及页面上显示日期时使用的时区
+	Timezone string `mapstructure:"timezone"`
+	// Permalink 文章地址的格式: /posts/:slug 或 /:year/:month/:slug
+	Permalink string `mapstructure:"permalink"`
+	// TrustedProxies 可信的反向代理地址或网段, 只有来自这些地址的请求才使用 X-Forwarded-For 中的访客 IP,
+	// 默认为空, 直接使用连接的 IP, 否则访客可以伪造 IP 绕过评论限流和点赞去重
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	location       *time.Location
+}
+
+// Location 站点时区, 配置无效时使用本地时区
+func (s SiteConfig) Location() *time.Location {
+	if s.location == nil {
+		return time.Local
+	}
+	return s.location
+}
+
+// AbsURL 用 domain 和 prefix 拼出站点内 path 的绝对地址
+func (s SiteConfig) AbsURL(path string) string {
+	domain := strings.TrimRight(s.Domain, "/")
+	if domain != "" && !strings.Contains(domain, "://") {
+		domain = "https://" + domain
+	}
+	return domain + s.Prefix + path
 }
 
 type Auth struct {
 	XAdminToken string `mapstructure:"XAdminToken"`
+	Secret      string `mapstructure:"secret"`      // 签名退订链接、访客 cookie 和预览链接
+	SecretFile  string `mapstructure:"secret_file"` // 未配置 secret 时自动生成的密钥保存在这里
+}
+
+type SmtpConfig struct {
+	Enable   bool   `mapstructure:"enable"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"` // 为空时不做认证, 方便对接本地测试用的 SMTP 服务
+	Password string `mapstructure:"password"`
+	SSL      bool   `mapstructure:"ssl"` // 465 端口的隐式 TLS, 否则在服务器支持时使用 STARTTLS
+	From     string `mapstructure:"from"`
+	Owner    string `mapstructure:"owner"`   // 接收新评论通知的站长邮箱
+	Retries  int    `mapstructure:"retries"` // 发送失败后的重试次数
 }
 
 type ImageHostingConfig struct {
@@ -37,19 +95,94 @@ type ImageHostingConfig struct {
 	AlbumId      string `mapstructure:"albumId"`
 }
 
+type CommentConfig struct {
+	Moderation bool `mapstructure:"moderation"` // 新评论需要审核后才显示
+	MaxDepth   int  `mapstructure:"max_depth"`  // 评论树的最大层级, 更深的回复挂到最深一层
+
+	// 反垃圾
+	RateLimit    float64  `mapstructure:"rate_limit"`    // 每个 IP 每分钟可发表的评论数, 0 表示不限制
+	RateBurst    int      `mapstructure:"rate_burst"`    // 令牌桶容量
+	MaxLength    int      `mapstructure:"max_length"`    // 评论最大字符数
+	MaxLinks     int      `mapstructure:"max_links"`     // 评论中最多包含的链接数, -1 表示不限制
+	BlockedWords []string `mapstructure:"blocked_words"` // 屏蔽词
+}
+
+type FeedConfig struct {
+	Limit int    `mapstructure:"limit"` // 每个订阅地址最多包含的文章数
+	Since string `mapstructure:"since"` // 订阅 ID(tag URI) 中的日期, 如 2025-01-01, 设置后不要修改
+}
+
+type CacheConfig struct {
+	Enable     bool          `mapstructure:"enable"`
+	TTL        time.Duration `mapstructure:"ttl"`         // 如 10m, 0 表示只在文章、评论、点赞变化时失效
+	MaxEntries int           `mapstructure:"max_entries"` // 每个缓存最多保存的条目数
+}
+
+type MarkdownConfig struct {
+	HighlightStyle string   `mapstructure:"highlight_style"` // chroma 代码高亮主题, 如 monokai
+	LineNumbers    bool     `mapstructure:"line_numbers"`
+	MermaidTheme   string   `mapstructure:"mermaid_theme"`
+	MermaidMode    string   `mapstructure:"mermaid_mode"`  // client, server, auto
+	MermaidCLI     string   `mapstructure:"mermaid_cli"`   // server 模式使用的 mmdc 路径
+	MermaidCache   string   `mapstructure:"mermaid_cache"` // 服务端渲染的 SVG 缓存目录
+	HardWraps      bool     `mapstructure:"hard_wraps"`    // 单个换行渲染为 <br>
+	Extensions     []string `mapstructure:"extensions"`    // footnote, definition_list, typographer, cjk
+	Math           bool     `mapstructure:"math"`          // $...$ 和 $$...$$ 公式, 由浏览器端的 KaTeX 渲染
+	KatexURL       string   `mapstructure:"katex_url"`     // KaTeX dist 目录的地址
+}
+
 type Config struct {
+	Database      DatabaseConfig       `mapstructure:"database"`
 	Mysql         MysqlConfig          `mapstructure:"mysql"`
+	Postgres      PostgresConfig       `mapstructure:"postgres"`
 	Auth          Auth                 `mapstructure:"auth"`
 	Site          SiteConfig           `mapstructure:"site"`
+	Comment       CommentConfig        `mapstructure:"comment"`
+	Smtp          SmtpConfig           `mapstructure:"smtp"`
+	Feed          FeedConfig           `mapstructure:"feed"`
+	Cache         CacheConfig          `mapstructure:"cache"`
+	Markdown      MarkdownConfig       `mapstructure:"markdown"`
 	ImageHostings []ImageHostingConfig `mapstructure:"imageHostings"`
 }
 
 func init() {
 	cfg := Config{}
 
+	viper.SetDefault("database.driver", "mysql")
+	viper.SetDefault("database.path", "lazyblog.db")
+	viper.SetDefault("database.timezone", "Asia/Shanghai")
+	viper.SetDefault("site.timezone", "Asia/Shanghai")
+	viper.SetDefault("site.permalink", "/posts/:slug")
+	viper.SetDefault("site.trusted_proxies", []string{})
+	viper.SetDefault("auth.secret_file", "secret.key")
+	viper.SetDefault("postgres.sslmode", "disable")
+	viper.SetDefault("comment.max_depth", 3)
+	viper.SetDefault("comment.rate_limit", 2)
+	viper.SetDefault("comment.rate_burst", 5)
+	viper.SetDefault("comment.max_length", 2000)
+	viper.SetDefault("comment.max_links", 2)
+	viper.SetDefault("smtp.port", 25)
+	viper.SetDefault("smtp.retries", 3)
+	viper.SetDefault("feed.limit", 20)
+	viper.SetDefault("feed.since", "2025-01-01")
+	viper.SetDefault("cache.enable", true)
+	viper.SetDefault("cache.ttl", "10m")
+	viper.SetDefault("cache.max_entries", 1000)
+	viper.SetDefault("markdown.highlight_style", "monokai")
+	viper.SetDefault("markdown.line_numbers", true)
+	viper.SetDefault("markdown.mermaid_theme", "dark")
+	viper.SetDefault("markdown.mermaid_mode", "client")
+	viper.SetDefault("markdown.mermaid_cli", "mmdc")
+	viper.SetDefault("markdown.mermaid_cache", "cache/mermaid")
+	viper.SetDefault("markdown.hard_wraps", true)
+	viper.SetDefault("markdown.math", true)
 	viper.SetConfigFile("config/config.toml")
 	viper.ReadInConfig()
 	viper.Unmarshal(&cfg)
+	if loc, err := time.LoadLocation(cfg.Site.Timezone); err == nil {
+		cfg.Site.location = loc
+	} else {
+		fmt.Printf("invalid site.timezone %q, use local timezone: %v\n", cfg.Site.Timezone, err)
+	}
 	Cfg = &cfg
-	fmt.Println("Cfg:", Cfg)
 }
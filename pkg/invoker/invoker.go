@@ -3,8 +3,11 @@ package invoker
 import (
 	"fmt"
 	"lazyblog/pkg/config"
+	"net/url"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -14,17 +17,49 @@ var (
 
 func Init() {
 	// init db
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Asia%%2FShanghai",
-		config.Cfg.Mysql.User,
-		config.Cfg.Mysql.Password,
-		config.Cfg.Mysql.Host,
-		config.Cfg.Mysql.Port,
-		config.Cfg.Mysql.Database,
-	)
-	fmt.Println("dsn:", dsn)
-	database, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	dialector, err := newDialector(config.Cfg)
+	if err != nil {
+		panic(err)
+	}
+	// TranslateError 把各数据库的唯一约束错误统一为 gorm.ErrDuplicatedKey
+	database, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
 	if err != nil {
 		panic(err)
 	}
 	DB = database
 }
+
+// newDialector 根据 database.driver 选择存储后端
+func newDialector(cfg *config.Config) (gorm.Dialector, error) {
+	switch cfg.Database.Driver {
+	case "", "mysql":
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=%s",
+			cfg.Mysql.User,
+			cfg.Mysql.Password,
+			cfg.Mysql.Host,
+			cfg.Mysql.Port,
+			cfg.Mysql.Database,
+			url.QueryEscape(cfg.Database.Timezone),
+		)
+		// dsn 中有密码, 只输出连接的地址
+		fmt.Printf("mysql: %s@%s:%d/%s\n", cfg.Mysql.User, cfg.Mysql.Host, cfg.Mysql.Port, cfg.Mysql.Database)
+		return mysql.Open(dsn), nil
+	case "postgres":
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s TimeZone=%s",
+			cfg.Postgres.Host,
+			cfg.Postgres.Port,
+			cfg.Postgres.User,
+			cfg.Postgres.Password,
+			cfg.Postgres.Database,
+			cfg.Postgres.SSLMode,
+			cfg.Database.Timezone,
+		)
+		fmt.Printf("postgres: %s@%s:%d/%s\n", cfg.Postgres.User, cfg.Postgres.Host, cfg.Postgres.Port, cfg.Postgres.Database)
+		return postgres.Open(dsn), nil
+	case "sqlite":
+		fmt.Println("sqlite:", cfg.Database.Path)
+		return sqlite.Open(cfg.Database.Path), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Database.Driver)
+	}
+}
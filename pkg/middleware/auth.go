@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"lazyblog/pkg/config"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth 校验 X-Admin-Token, 未配置 token 时拒绝所有请求
+func AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Admin-Token")
+		if config.Cfg.Auth.XAdminToken == "" || token != config.Cfg.Auth.XAdminToken {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
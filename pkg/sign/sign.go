@@ -0,0 +1,98 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"lazyblog/pkg/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	once   sync.Once
+	key    []byte
+	keyErr error
+)
+
+// Init 加载签名密钥: 优先使用 auth.secret, 未配置时读取 auth.secret_file, 文件不存在时生成随机密钥并保存.
+// 不使用 XAdminToken 作为密钥, 密钥无法加载时 Sign 返回空字符串, Verify 总是失败
+func Init() error {
+	once.Do(func() {
+		key, keyErr = load()
+	})
+	return keyErr
+}
+
+func load() ([]byte, error) {
+	if config.Cfg.Auth.Secret != "" {
+		return []byte(config.Cfg.Auth.Secret), nil
+	}
+	name := config.Cfg.Auth.SecretFile
+	if name == "" {
+		return nil, errors.New("auth.secret and auth.secret_file are both empty")
+	}
+	if s, err := readSecret(name); err == nil {
+		return []byte(s), nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	s := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	// O_EXCL: 同时启动的其他进程已经生成时使用它的密钥
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		s, err := readSecret(name)
+		return []byte(s), err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("save secret to %s: %w", name, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s + "\n"); err != nil {
+		return nil, fmt.Errorf("save secret to %s: %w", name, err)
+	}
+	return []byte(s), nil
+}
+
+func readSecret(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "" {
+		return "", fmt.Errorf("secret file %s is empty", name)
+	}
+	return s, nil
+}
+
+// Sign 使用签名密钥对 data 做 HMAC-SHA256 签名
+func Sign(data string) string {
+	if Init() != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(data, signature string) bool {
+	if Init() != nil || signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(data)), []byte(signature))
+}